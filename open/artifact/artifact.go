@@ -0,0 +1,303 @@
+package artifact
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"open/loglevel"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	packageFileName = "install.tar.gz"
+	metaFileName    = "meta.json"
+	minPinLength    = 8
+)
+
+var (
+	infoLogger = loglevel.GetInfoLogger()
+	httpClient = &http.Client{Timeout: 10 * time.Minute}
+
+	// requiredEntries 安装包顶层必须包含的文件和目录，与 package.yaml 打包的内容一致
+	requiredEntries = []string{"p8_app_server", "server.sh", "proto", "etc", "lua"}
+)
+
+// Meta 安装包元数据，与安装包一起保存在以 SHA-256 命名的目录中。
+type Meta struct {
+	SHA256    string    `json:"sha256"`
+	Size      int64     `json:"size"`
+	SourceNum int       `json:"source_num,omitempty"` // 拉取安装包的 game 编号
+	Source    string    `json:"source,omitempty"`     // 发布包的本地路径或 URL
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// Version 返回用于日志和状态文件的短版本号，即 SHA-256 的前 12 位。
+func (m *Meta) Version() string {
+	return m.SHA256[:12]
+}
+
+// SourceName 返回安装包来源的描述。
+func (m *Meta) SourceName() string {
+	if m.Source != "" {
+		return m.Source
+	}
+	return fmt.Sprintf("game%d", m.SourceNum)
+}
+
+// Store 按内容哈希保存安装包，目录结构为 <Dir>/<sha256>/install.tar.gz 和 meta.json。
+type Store struct {
+	Dir string
+}
+
+// Open 打开安装包仓库，目录不存在时创建。
+// 参数:
+//
+//	dir: 仓库根目录。
+//
+// 返回值:
+//
+//	*Store: 安装包仓库。
+//	error: 如果目录创建失败，返回错误信息；否则返回 nil。
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建安装包仓库目录失败: %v", err)
+	}
+	return &Store{Dir: dir}, nil
+}
+
+// Path 返回安装包文件路径。
+func (s *Store) Path(m *Meta) string {
+	return filepath.Join(s.Dir, m.SHA256, packageFileName)
+}
+
+// Put 将从旧 game 拉取的安装包存入仓库，存入成功后删除 src。
+// 参数:
+//
+//	src: 刚拉取的安装包路径。
+//	sourceNum: 拉取安装包的 game 编号。
+//
+// 返回值:
+//
+//	*Meta: 安装包元数据。
+//	error: 如果读取、校验或写入失败，返回错误信息；否则返回 nil。
+func (s *Store) Put(src string, sourceNum int) (*Meta, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return nil, fmt.Errorf("打开安装包失败: %v", err)
+	}
+	defer in.Close()
+
+	meta, err := s.add(in, Meta{SourceNum: sourceNum})
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(src)
+	return meta, nil
+}
+
+// Import 将发布包存入仓库，发布包可以是本地路径或 http(s) 地址。
+// 参数:
+//
+//	source: 发布包本地路径或 URL。
+//
+// 返回值:
+//
+//	*Meta: 安装包元数据。
+//	error: 如果下载、读取、校验或写入失败，返回错误信息；否则返回 nil。
+func (s *Store) Import(source string) (*Meta, error) {
+	var in io.ReadCloser
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		resp, err := httpClient.Get(source)
+		if err != nil {
+			return nil, fmt.Errorf("下载发布包失败: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("下载发布包失败, 状态码: %d", resp.StatusCode)
+		}
+		in = resp.Body
+	} else {
+		file, err := os.Open(source)
+		if err != nil {
+			return nil, fmt.Errorf("打开发布包失败: %v", err)
+		}
+		in = file
+	}
+	defer in.Close()
+	return s.add(in, Meta{Source: source})
+}
+
+// add 计算安装包的 SHA-256 并存入仓库，存入前完整读取一遍压缩包并检查目录结构，拉取不完整的包会被拒绝。
+// 相同内容的安装包已存在时直接返回已有的元数据。
+func (s *Store) add(in io.Reader, meta Meta) (*Meta, error) {
+	// 仓库和运行目录可能在不同的挂载点上，不能直接 rename，先复制到仓库内的临时文件
+	tmp, err := os.CreateTemp(s.Dir, ".put-*")
+	if err != nil {
+		return nil, fmt.Errorf("创建临时文件失败: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), in)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("复制安装包失败: %v", err)
+	}
+	if err = checkArchive(tmp.Name()); err != nil {
+		return nil, err
+	}
+
+	meta.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	meta.Size = size
+	meta.FetchedAt = time.Now()
+	if existing, err := s.Get(meta.SHA256); err == nil {
+		infoLogger.Printf("安装包 %s 已存在于仓库中", existing.Version())
+		return existing, nil
+	}
+
+	dir := filepath.Join(s.Dir, meta.SHA256)
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建安装包目录失败: %v", err)
+	}
+	if err = os.Rename(tmp.Name(), filepath.Join(dir, packageFileName)); err != nil {
+		return nil, fmt.Errorf("保存安装包失败: %v", err)
+	}
+	content, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("序列化安装包元数据失败: %v", err)
+	}
+	// 元数据最后写入，没有 meta.json 的目录视为未完成
+	if err = os.WriteFile(filepath.Join(dir, metaFileName), append(content, '\n'), 0644); err != nil {
+		return nil, fmt.Errorf("写入安装包元数据失败: %v", err)
+	}
+	infoLogger.Printf("安装包 %s 已存入仓库, 大小 %d 字节, 来源: %s", meta.Version(), meta.Size, meta.SourceName())
+	return &meta, nil
+}
+
+// Get 按 SHA-256 或其前缀（至少 8 位）查找安装包。
+// 参数:
+//
+//	id: SHA-256 或其前缀。
+//
+// 返回值:
+//
+//	*Meta: 安装包元数据。
+//	error: 如果不存在、前缀不唯一或元数据损坏，返回错误信息；否则返回 nil。
+func (s *Store) Get(id string) (*Meta, error) {
+	id = strings.ToLower(id)
+	if len(id) < minPinLength {
+		return nil, fmt.Errorf("安装包版本 %s 过短，至少 %d 位", id, minPinLength)
+	}
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取安装包仓库失败: %v", err)
+	}
+	var match string
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), id) {
+			continue
+		}
+		if match != "" {
+			return nil, fmt.Errorf("安装包版本 %s 匹配多个安装包", id)
+		}
+		match = entry.Name()
+	}
+	if match == "" {
+		return nil, fmt.Errorf("安装包仓库中不存在版本 %s", id)
+	}
+
+	content, err := os.ReadFile(filepath.Join(s.Dir, match, metaFileName))
+	if err != nil {
+		return nil, fmt.Errorf("读取安装包 %s 元数据失败: %v", match, err)
+	}
+	meta := new(Meta)
+	if err = json.Unmarshal(content, meta); err != nil {
+		return nil, fmt.Errorf("解析安装包 %s 元数据失败: %v", match, err)
+	}
+	if meta.SHA256 != match {
+		return nil, fmt.Errorf("安装包 %s 元数据与目录名不一致", match)
+	}
+	return meta, nil
+}
+
+// Verify 安装前重新计算安装包的大小和 SHA-256，与元数据比对。
+// 参数:
+//
+//	m: 安装包元数据。
+//
+// 返回值:
+//
+//	error: 如果文件缺失或内容与元数据不一致，返回错误信息；否则返回 nil。
+func (s *Store) Verify(m *Meta) error {
+	file, err := os.Open(s.Path(m))
+	if err != nil {
+		return fmt.Errorf("打开安装包 %s 失败: %v", m.Version(), err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return fmt.Errorf("读取安装包 %s 失败: %v", m.Version(), err)
+	}
+	if size != m.Size {
+		return fmt.Errorf("安装包 %s 大小为 %d, 元数据记录为 %d", m.Version(), size, m.Size)
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != m.SHA256 {
+		return fmt.Errorf("安装包 %s 校验失败, 实际 SHA-256 为 %s", m.Version(), sum)
+	}
+	return nil
+}
+
+// checkArchive 完整读取 tar.gz 并检查顶层目录结构，截断或损坏的压缩包会在这里报错。
+func checkArchive(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("安装包不是有效的 gzip 文件: %v", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	entries := make(map[string]bool)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("安装包已损坏: %v", err)
+		}
+		if _, err = io.Copy(io.Discard, tr); err != nil {
+			return fmt.Errorf("安装包已损坏: %v", err)
+		}
+		top, _, _ := strings.Cut(strings.TrimPrefix(header.Name, "./"), "/")
+		entries[top] = true
+	}
+	var missing []string
+	for _, name := range requiredEntries {
+		if !entries[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("安装包缺少 %s", strings.Join(missing, "、"))
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package cdn
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"open/redact"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Auth 端点的认证和 TLS 配置，均为可选，密钥只从文件读取，每次请求时重新读取以便轮换，CA 证书在首次请求时读取。
+type Auth struct {
+	// HMACSecretFile HMAC-SHA256 签名密钥文件。配置后在查询参数中追加 timestamp、nonce 和 sign，
+	// sign 为对 "方法\n路径\n排序后的查询参数（不含 sign）" 计算的十六进制 HMAC-SHA256。
+	HMACSecretFile string `json:"hmac_secret_file"`
+	// TokenFile Bearer token 文件，配置后设置 Authorization: Bearer <token>。
+	TokenFile string `json:"token_file"`
+	// CAFile 自定义 CA 证书文件（PEM），用于校验 https 端点的证书。
+	CAFile string `json:"ca_file"`
+}
+
+// validate 检查配置的文件是否可读。
+func (a *Auth) validate() error {
+	for _, path := range []string{a.HMACSecretFile, a.TokenFile} {
+		if path == "" {
+			continue
+		}
+		if _, err := readSecret(path); err != nil {
+			return err
+		}
+	}
+	if a.CAFile != "" {
+		if _, err := a.client(defaultTimeout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// client 返回使用自定义 CA 的 HTTP 客户端，未配置 CAFile 时使用系统 CA。
+func (a *Auth) client(timeout time.Duration) (*http.Client, error) {
+	client := &http.Client{Timeout: timeoutOr(timeout)}
+	if a.CAFile == "" {
+		return client, nil
+	}
+	pem, err := os.ReadFile(a.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("读取 CA 证书失败: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("CA 证书 %s 中没有有效的 PEM 证书", a.CAFile)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	client.Transport = transport
+	return client, nil
+}
+
+// clientCache 缓存端点的 HTTP 客户端，首次请求时创建。每次请求都新建 Transport 会使空闲的长连接不断堆积。
+// 缓存后替换 CA 证书文件需要重启才能生效，密钥和 token 仍每次请求时读取。
+type clientCache struct {
+	once   sync.Once
+	client *http.Client
+	err    error
+}
+
+// get 返回缓存的客户端，首次调用时按 auth 和 timeout 创建。
+func (c *clientCache) get(a *Auth, timeout time.Duration) (*http.Client, error) {
+	c.once.Do(func() {
+		c.client, c.err = a.client(timeout)
+	})
+	return c.client, c.err
+}
+
+// apply 为请求添加 Bearer token 和 HMAC 签名。
+func (a *Auth) apply(req *http.Request) error {
+	if a.TokenFile != "" {
+		token, err := readSecret(a.TokenFile)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if a.HMACSecretFile == "" {
+		return nil
+	}
+	secret, err := readSecret(a.HMACSecretFile)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, 16)
+	if _, err = rand.Read(nonce); err != nil {
+		return fmt.Errorf("生成 nonce 失败: %v", err)
+	}
+
+	query := req.URL.Query()
+	query.Del("sign")
+	query.Set("timestamp", strconv.FormatInt(time.Now().Unix(), 10))
+	query.Set("nonce", hex.EncodeToString(nonce))
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%s", req.Method, req.URL.EscapedPath(), query.Encode())
+	query.Set("sign", hex.EncodeToString(mac.Sum(nil)))
+	req.URL.RawQuery = query.Encode()
+	return nil
+}
+
+// readSecret 读取密钥文件，去掉首尾空白。
+func readSecret(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("读取密钥文件失败: %v", err)
+	}
+	secret := strings.TrimSpace(string(content))
+	if secret == "" {
+		return "", fmt.Errorf("密钥文件 %s 为空", path)
+	}
+	redact.Register(secret)
+	return secret, nil
+}
@@ -5,26 +5,93 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"open/check"
 	"open/loglevel"
+	"os"
 	"strconv"
+	"sync"
 	"time"
 )
 
-var successLogger = loglevel.GetSuccessLogger()
+// 端点类型
+const (
+	TypeLegacy = "legacy" // GET cdnURL?zone_id=N，返回 {code,message}，code 为 0 表示成功
+	TypeHTTP   = "http"   // 通用 HTTP 接口，方法、请求头、请求体和成功判断均可配置
+)
+
+const defaultTimeout = 5 * time.Second
+
+var (
+	infoLogger    = loglevel.GetInfoLogger()
+	successLogger = loglevel.GetSuccessLogger()
+	errLogger     = loglevel.GetErrLogger()
+)
+
+// Provider 一个 CDN 刷新端点。
+type Provider interface {
+	// Name 返回端点名称，用于日志和报告。
+	Name() string
+	// Flush 刷新指定 game 编号对应的区服列表。
+	Flush(num int) error
+}
 
+// Endpoint cdn.json 中单个端点的配置。
+type Endpoint struct {
+	Name         string            `json:"name"`
+	Type         string            `json:"type"`   // legacy 或 http，默认 legacy
+	URL          string            `json:"url"`    // 地址，http 类型中 {num} 替换为 game 编号
+	Method       string            `json:"method"` // http 类型的请求方法，默认 GET
+	Headers      map[string]string `json:"headers"`
+	Body         string            `json:"body"`          // http 类型的请求体，{num} 替换为 game 编号
+	SuccessPath  string            `json:"success_path"`  // http 类型响应 JSON 中判断成功的字段路径，例如 data.code，为空时只检查状态码
+	SuccessValue string            `json:"success_value"` // 成功时该字段的值，例如 0
+	Timeout      int               `json:"timeout"`       // 超时秒数，默认 5
+	Auth
+}
+
+// RequestData legacy 端点的响应。
 type RequestData struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
 }
 
-func FlushCDN(num int, cdnURL string) error {
+// Legacy 原有的 CDN 刷新接口。
+type Legacy struct {
+	EndpointName string
+	URL          string
+	Timeout      time.Duration
+	Auth         Auth
+
+	clients clientCache
+}
+
+// Name 返回端点名称。
+func (l *Legacy) Name() string {
+	if l.EndpointName != "" {
+		return l.EndpointName
+	}
+	return l.URL
+}
+
+// Flush 以 GET 请求调用刷新接口，返回 code 为 0 时成功。
+func (l *Legacy) Flush(num int) error {
 	params := url.Values{
 		"zone_id": []string{strconv.Itoa(num)},
 	}
-	fullURL := cdnURL + "?" + params.Encode()
+	fullURL := l.URL + "?" + params.Encode()
 
-	client := &http.Client{Timeout: 5 * time.Second} // 5s 超时
-	resp, err := client.Get(fullURL)
+	req, err := http.NewRequest(http.MethodGet, fullURL, nil)
+	if err != nil {
+		return fmt.Errorf("构造请求失败: %w", err)
+	}
+	if err = l.Auth.apply(req); err != nil {
+		return err
+	}
+	client, err := l.clients.get(&l.Auth, l.Timeout)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("HTTP 请求失败: %w", err)
 	}
@@ -42,7 +109,127 @@ func FlushCDN(num int, cdnURL string) error {
 	if reqData.Code != 0 {
 		return fmt.Errorf("返回状态非 0，Message: %s", reqData.Message)
 	}
-
-	successLogger.Printf("CDN 刷新成功，zone_id: %d", num)
 	return nil
 }
+
+// NewLegacy 根据环境变量配置创建 legacy 端点。
+// 参数:
+//
+//	cdnURL: 刷新接口地址。
+//	auth: 认证和 TLS 配置。
+//
+// 返回值:
+//
+//	*Legacy: legacy 端点。
+//	error: 如果认证配置中的文件不可用，返回错误信息；否则返回 nil。
+func NewLegacy(cdnURL string, auth Auth) (*Legacy, error) {
+	if err := auth.validate(); err != nil {
+		return nil, err
+	}
+	return &Legacy{URL: cdnURL, Auth: auth}, nil
+}
+
+// Load 读取 cdn.json 中的端点配置。
+// 参数:
+//
+//	path: 配置文件路径，内容为 Endpoint 数组。
+//
+// 返回值:
+//
+//	[]Provider: 端点列表。
+//	error: 如果文件读取、解析失败或配置无效，返回错误信息；否则返回 nil。
+func Load(path string) ([]Provider, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var endpoints []Endpoint
+	if err = json.Unmarshal(content, &endpoints); err != nil {
+		return nil, fmt.Errorf("解析 CDN 配置失败: %v", err)
+	}
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("CDN 配置中没有端点")
+	}
+
+	providers := make([]Provider, 0, len(endpoints))
+	names := make(map[string]bool)
+	for i, ep := range endpoints {
+		if ep.URL == "" {
+			return nil, fmt.Errorf("第%d个 CDN 端点缺少 url", i+1)
+		}
+		if ep.Name == "" {
+			ep.Name = ep.URL
+		}
+		if names[ep.Name] {
+			return nil, fmt.Errorf("CDN 端点名称 %s 重复", ep.Name)
+		}
+		names[ep.Name] = true
+		timeout := time.Duration(ep.Timeout) * time.Second
+		if err = ep.Auth.validate(); err != nil {
+			return nil, fmt.Errorf("CDN 端点 %s: %v", ep.Name, err)
+		}
+
+		switch ep.Type {
+		case "", TypeLegacy:
+			providers = append(providers, &Legacy{EndpointName: ep.Name, URL: ep.URL, Timeout: timeout, Auth: ep.Auth})
+		case TypeHTTP:
+			if (ep.SuccessPath == "") != (ep.SuccessValue == "") {
+				return nil, fmt.Errorf("CDN 端点 %s 的 success_path 和 success_value 需同时配置", ep.Name)
+			}
+			providers = append(providers, &HTTP{
+				EndpointName: ep.Name,
+				URL:          ep.URL,
+				Method:       ep.Method,
+				Headers:      ep.Headers,
+				Body:         ep.Body,
+				SuccessPath:  ep.SuccessPath,
+				SuccessValue: ep.SuccessValue,
+				Timeout:      timeout,
+				Auth:         ep.Auth,
+			})
+		default:
+			return nil, fmt.Errorf("CDN 端点 %s 类型 %s 无效，只支持 legacy 或 http", ep.Name, ep.Type)
+		}
+	}
+	return providers, nil
+}
+
+// FlushCDN 并发刷新所有端点。
+// 参数:
+//
+//	num: 新开的 game 编号。
+//	providers: CDN 端点列表。
+//
+// 返回值:
+//
+//	*check.Report: 每个端点的刷新结果。
+func FlushCDN(num int, providers []Provider) *check.Report {
+	errs := make([]error, len(providers))
+	var wg sync.WaitGroup
+	for i, provider := range providers {
+		wg.Add(1)
+		go func(i int, provider Provider) {
+			defer wg.Done()
+			errs[i] = provider.Flush(num)
+		}(i, provider)
+	}
+	wg.Wait()
+
+	report := new(check.Report)
+	for i, provider := range providers {
+		report.Add("CDN 刷新", provider.Name(), errs[i])
+	}
+	if report.Failed() {
+		errLogger.Printf("CDN 刷新失败，zone_id: %d\n%s", num, report)
+	} else {
+		successLogger.Printf("CDN 刷新成功，zone_id: %d\n%s", num, report)
+	}
+	return report
+}
+
+func timeoutOr(timeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		return defaultTimeout
+	}
+	return timeout
+}
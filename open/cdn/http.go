@@ -0,0 +1,106 @@
+package cdn
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"open/jsonpath"
+)
+
+// HTTP 通用 HTTP 刷新接口。
+type HTTP struct {
+	EndpointName string
+	URL          string
+	Method       string
+	Headers      map[string]string
+	Body         string
+	SuccessPath  string
+	SuccessValue string
+	Timeout      time.Duration
+	Auth         Auth
+
+	clients clientCache
+}
+
+// Name 返回端点名称。
+func (h *HTTP) Name() string {
+	if h.EndpointName != "" {
+		return h.EndpointName
+	}
+	return h.URL
+}
+
+// Flush 按配置发送请求，返回 2xx 且 SuccessPath 处的值等于 SuccessValue 时成功。
+func (h *HTTP) Flush(num int) error {
+	method := h.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	var body io.Reader
+	if h.Body != "" {
+		body = strings.NewReader(expand(h.Body, num))
+	}
+	req, err := http.NewRequest(method, expand(h.URL, num), body)
+	if err != nil {
+		return fmt.Errorf("构造请求失败: %w", err)
+	}
+	for key, value := range h.Headers {
+		req.Header.Set(key, expand(value, num))
+	}
+	if err = h.Auth.apply(req); err != nil {
+		return err
+	}
+
+	client, err := h.clients.get(&h.Auth, h.Timeout)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("HTTP 请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("读取响应体失败: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP 状态码错误: %d", resp.StatusCode)
+	}
+	if h.SuccessPath == "" {
+		return nil
+	}
+
+	var data interface{}
+	if err = json.Unmarshal(content, &data); err != nil {
+		return fmt.Errorf("解析响应体失败: %w", err)
+	}
+	value, ok := jsonpath.Lookup(data, h.SuccessPath)
+	if !ok {
+		return fmt.Errorf("响应中不存在字段 %s: %s", h.SuccessPath, truncate(string(content)))
+	}
+	if got := jsonpath.Format(value); got != h.SuccessValue {
+		return fmt.Errorf("字段 %s 为 %s，期望 %s: %s", h.SuccessPath, got, h.SuccessValue, truncate(string(content)))
+	}
+	return nil
+}
+
+// expand 将 {num} 替换为 game 编号。
+func expand(s string, num int) string {
+	return strings.ReplaceAll(s, "{num}", strconv.Itoa(num))
+}
+
+func truncate(s string) string {
+	const max = 200
+	s = strings.TrimSpace(s)
+	if len(s) > max {
+		return s[:max] + "..."
+	}
+	return s
+}
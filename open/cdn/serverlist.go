@@ -0,0 +1,136 @@
+package cdn
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"open/jsonpath"
+)
+
+const (
+	defaultVerifyTimeout  = 2 * time.Minute
+	defaultVerifyInterval = 10 * time.Second
+)
+
+// ServerList 客户端下载的区服列表，用于确认 CDN 刷新已生效。
+type ServerList struct {
+	URL       string        // 区服列表地址，{num} 替换为 game 编号
+	IDField   string        // 区服对象中区服编号的字段名
+	IPField   string        // 区服对象中 IP 的字段名，为空时不检查
+	PortField string        // 区服对象中端口的字段名，为空时不检查
+	Timeout   time.Duration // 轮询总超时，为 0 时使用 2 分钟
+	Interval  time.Duration // 轮询间隔，为 0 时使用 10 秒
+	Auth      Auth
+
+	clients clientCache
+}
+
+// Verify 轮询区服列表，直到出现指定 game 编号且 IP、端口与期望一致，或超时。
+// 参数:
+//
+//	num: 新开的 game 编号。
+//	ip: 期望的 game IP。
+//	port: 期望的 game 端口。
+//
+// 返回值:
+//
+//	error: 如果超时仍未出现或与期望不一致，返回最后一次的错误信息；否则返回 nil。
+func (s *ServerList) Verify(num int, ip string, port int) error {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = defaultVerifyTimeout
+	}
+	interval := s.Interval
+	if interval <= 0 {
+		interval = defaultVerifyInterval
+	}
+
+	deadline := time.Now().Add(timeout)
+	for attempt := 1; ; attempt++ {
+		err := s.check(num, ip, port)
+		if err == nil {
+			successLogger.Printf("区服列表已包含 zone_id: %d", num)
+			return nil
+		}
+		if time.Now().Add(interval).After(deadline) {
+			return fmt.Errorf("等待 %v 后区服列表仍未生效: %v", timeout, err)
+		}
+		infoLogger.Printf("区服列表第 %d 次检查未通过: %v, %v 后重试", attempt, err, interval)
+		time.Sleep(interval)
+	}
+}
+
+// check 获取一次区服列表并查找指定 game 编号。
+func (s *ServerList) check(num int, ip string, port int) error {
+	req, err := http.NewRequest(http.MethodGet, expand(s.URL, num), nil)
+	if err != nil {
+		return fmt.Errorf("构造请求失败: %w", err)
+	}
+	// 避免中间缓存返回旧列表
+	req.Header.Set("Cache-Control", "no-cache")
+	if err = s.Auth.apply(req); err != nil {
+		return err
+	}
+	client, err := s.clients.get(&s.Auth, 0)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("HTTP 请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP 状态码错误: %d", resp.StatusCode)
+	}
+	content, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return fmt.Errorf("读取响应体失败: %w", err)
+	}
+	var data interface{}
+	if err = json.Unmarshal(content, &data); err != nil {
+		return fmt.Errorf("解析区服列表失败: %w", err)
+	}
+
+	zone := findZone(data, s.IDField, strconv.Itoa(num))
+	if zone == nil {
+		return fmt.Errorf("区服列表中没有 %s=%d", s.IDField, num)
+	}
+	if s.IPField != "" {
+		if got := jsonpath.Format(zone[s.IPField]); got != ip {
+			return fmt.Errorf("区服 %d 的 %s 为 %s，期望 %s", num, s.IPField, got, ip)
+		}
+	}
+	if s.PortField != "" {
+		if got := jsonpath.Format(zone[s.PortField]); got != strconv.Itoa(port) {
+			return fmt.Errorf("区服 %d 的 %s 为 %s，期望 %d", num, s.PortField, got, port)
+		}
+	}
+	return nil
+}
+
+// findZone 在 JSON 中递归查找 idField 字段等于 id 的对象，不要求固定的列表结构。
+func findZone(data interface{}, idField, id string) map[string]interface{} {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		if value, ok := v[idField]; ok && jsonpath.Format(value) == id {
+			return v
+		}
+		for _, child := range v {
+			if zone := findZone(child, idField, id); zone != nil {
+				return zone
+			}
+		}
+	case []interface{}:
+		for _, child := range v {
+			if zone := findZone(child, idField, id); zone != nil {
+				return zone
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package check
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Check 单项检查结果，Err 为 nil 表示通过。
+type Check struct {
+	Name   string
+	Target string
+	Err    error
+}
+
+// Report 一组检查项的结果，用于开服前检查和开服后验证。
+type Report struct {
+	Checks []Check
+}
+
+// Add 追加一项检查结果。
+func (r *Report) Add(name, target string, err error) {
+	r.Checks = append(r.Checks, Check{Name: name, Target: target, Err: err})
+}
+
+// Failed 返回是否存在未通过的检查项。
+func (r *Report) Failed() bool {
+	for _, c := range r.Checks {
+		if c.Err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// String 按检查顺序输出每项结果。
+func (r *Report) String() string {
+	var b strings.Builder
+	for _, c := range r.Checks {
+		if c.Err != nil {
+			fmt.Fprintf(&b, "  [失败] %s %s: %v\n", c.Name, c.Target, c.Err)
+		} else {
+			fmt.Fprintf(&b, "  [通过] %s %s\n", c.Name, c.Target)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"open/cdn"
+	"open/execute"
+	"open/getsomething"
+	"open/layout"
+	"open/logdb"
+	"open/loginreload"
+	"open/notify"
+	"open/online"
+	"open/portalloc"
+	"open/redact"
+	"open/render"
+)
+
+type InstallStruct struct {
+	domain         string
+	thread         int
+	payNotifyUrl   string
+	zk1IP          string
+	zk1Port        int
+	zk2IP          string
+	zk2Port        int
+	zk3IP          string
+	zk3Port        int
+	gameDBHost     string
+	gameDBUser     string
+	gameDBPassword string
+	gameIndexNum   int
+}
+
+// gameConfig 返回 game 配置文件的公共部分
+func (i *InstallStruct) gameConfig() render.GameConfig {
+	return render.GameConfig{
+		Domain: i.domain,
+		Thread: i.thread,
+		Discovers: []render.Discover{
+			{IP: i.zk1IP, Port: i.zk1Port},
+			{IP: i.zk2IP, Port: i.zk2Port},
+			{IP: i.zk3IP, Port: i.zk3Port},
+		},
+		GameDB: render.GameDB{
+			Host:     i.gameDBHost,
+			User:     i.gameDBUser,
+			Password: i.gameDBPassword,
+		},
+		GameIndexNum: i.gameIndexNum,
+		PayNotifyURL: i.payNotifyUrl,
+	}
+}
+
+// config 单个项目的配置，来自环境变量，多项目时由项目目录下的 project.env 覆盖
+type config struct {
+	workMode              string
+	cdnURL                string
+	cdnAuth               cdn.Auth
+	serverList            *cdn.ServerList
+	loginListFilePath     string
+	logDB                 getsomething.DBOptions
+	logDBMaxBackoff       time.Duration
+	logDBOutageNotify     time.Duration
+	notifier              notify.Notifier
+	criticalRegisterCount int
+	criticalRechargeCount int
+	criticalMoney         int
+	criticalOnline        int
+	onlineSource          string
+	onlineSQL             string
+	onlineURL             string
+	onlineField           string
+	sleepInterval         int
+	runLogKeep            int
+	rateWindow            time.Duration
+	rateTrigger           time.Duration
+	verifyProbe           string
+	prewarmPercent        int
+	portStrategy          string
+	portBase              int
+	portStep              int
+	gameDBProvision       bool
+	gameDBAdminUser       string
+	gameDBAdminPassword   string
+	preflightMinFreeMB    int
+	artifactPin           string
+	releasePackage        string
+	loginParallel         int
+	loginQuorum           string
+	loginReload           string
+	loginAdminEndpoints   []string
+	loginAdminCommand     string
+	loginAdminAck         string
+	installExamples       InstallStruct
+	gameLayout            layout.Layout
+}
+
+// loadEnvFile 读取 KEY=VALUE 格式的文件，忽略空行和 # 开头的注释行
+func loadEnvFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s 第%d行格式错误，应为 KEY=VALUE", filepath.Base(path), lineNum)
+		}
+		values[strings.TrimSpace(key)] = strings.Trim(strings.TrimSpace(value), `"'`)
+	}
+	return values, scanner.Err()
+}
+
+// envLookup 返回先查 overrides 再查环境变量的取值函数
+func envLookup(overrides map[string]string) func(string) string {
+	return func(key string) string {
+		if v, ok := overrides[key]; ok {
+			return v
+		}
+		return os.Getenv(key)
+	}
+}
+
+// rateWindowEnv 读取注册速率统计窗口，未配置时为 defaultRateWindow 分钟，open history 也使用它以便与守护进程一致
+func rateWindowEnv(getenv func(string) string) (time.Duration, error) {
+	v := getenv("rateWindow")
+	if v == "" {
+		return defaultRateWindow * time.Minute, nil
+	}
+	minutes, err := strconv.Atoi(v)
+	if err != nil || minutes <= 0 {
+		return 0, errors.New("注册速率统计窗口无效")
+	}
+	return time.Duration(minutes) * time.Minute, nil
+}
+
+// secretEnv 读取密钥，配置了 <key>_FILE 时从该文件读取（Docker secrets 方式），否则读取 <key>，
+// 读取的值登记到日志屏蔽，<key> 和 <key>_FILE 不传给子进程
+func secretEnv(getenv func(string) string, key string) (string, error) {
+	value := getenv(key)
+	if path := getenv(key + "_FILE"); path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("读取 %s_FILE 失败: %v", key, err)
+		}
+		value = strings.TrimSpace(string(content))
+	}
+	redact.RegisterEnv(key, key+"_FILE")
+	redact.Register(value)
+	return value, nil
+}
+
+func loadConfig(getenv func(string) string) (*config, error) {
+	var err error
+	c := &config{gameLayout: layout.Default()}
+	c.workMode = getenv("workMode")
+	c.cdnURL = getenv("cdnURL")
+	c.cdnAuth = cdn.Auth{
+		HMACSecretFile: getenv("cdnHMACSecretFile"),
+		TokenFile:      getenv("cdnTokenFile"),
+		CAFile:         getenv("cdnCAFile"),
+	}
+	c.verifyProbe = getenv("verifyProbe")
+	c.artifactPin = getenv("artifactPin")
+	c.releasePackage = getenv("releasePackage")
+	c.gameDBAdminUser = getenv("gameDBAdminUser")
+	if c.gameDBAdminPassword, err = secretEnv(getenv, "gameDBAdminPassword"); err != nil {
+		return nil, err
+	}
+	c.loginListFilePath = getenv("loginListFilePath")
+	c.gameLayout.ListDir = c.loginListFilePath
+	for env, field := range map[string]*string{
+		"layoutGameDBName": &c.gameLayout.GameDBName,
+		"layoutGameDir":    &c.gameLayout.GameDir,
+		"layoutTmpDir":     &c.gameLayout.TmpDir,
+		"layoutUpdateDir":  &c.gameLayout.UpdateDir,
+		"layoutDataDir":    &c.gameLayout.DataDir,
+		"layoutLoginRoot":  &c.gameLayout.LoginRoot,
+		"layoutWhiteList":  &c.gameLayout.WhiteList,
+		"layoutLimitList":  &c.gameLayout.LimitList,
+	} {
+		if v := getenv(env); v != "" {
+			*field = v
+		}
+	}
+	c.logDB.Host = getenv("logDBHost")
+	c.logDB.User = getenv("logDBUser")
+	if c.logDB.Password, err = secretEnv(getenv, "logDBPassword"); err != nil {
+		return nil, err
+	}
+	c.logDB.Name = getenv("logDBName")
+	c.installExamples.domain = getenv("domain")
+	c.installExamples.payNotifyUrl = getenv("payNotifyUrl")
+	c.installExamples.zk1IP = getenv("zk1IP")
+	c.installExamples.zk2IP = getenv("zk2IP")
+	c.installExamples.zk3IP = getenv("zk3IP")
+	c.installExamples.gameDBHost = getenv("gameDBHost")
+	c.installExamples.gameDBUser = getenv("gameDBUser")
+	if c.installExamples.gameDBPassword, err = secretEnv(getenv, "gameDBPassword"); err != nil {
+		return nil, err
+	}
+
+	c.logDB.Port, err = strconv.Atoi(getenv("logDBPort"))
+	if err != nil || c.logDB.Port <= 0 {
+		return nil, errors.New("日志数据库端口无效")
+	}
+	for _, replica := range strings.Split(getenv("logDBReplicas"), ",") {
+		if replica = strings.TrimSpace(replica); replica != "" {
+			c.logDB.Replicas = append(c.logDB.Replicas, replica)
+		}
+	}
+	c.logDB.Params = getenv("logDBParams")
+	if _, err = getsomething.ParseDSNParams(c.logDB.Params); err != nil {
+		return nil, err
+	}
+	if v := getenv("logDBTLS"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, errors.New("logDBTLS 只支持 true 或 false")
+		}
+		if enabled {
+			c.logDB.TLS, err = getsomething.LoadTLSConfig(getenv("logDBTLSCAFile"), getenv("logDBTLSCertFile"),
+				getenv("logDBTLSKeyFile"), getenv("logDBTLSServerName"))
+			if err != nil {
+				return nil, fmt.Errorf("日志数据库 TLS 配置无效: %v", err)
+			}
+		}
+	}
+	c.logDB.MaxOpenConns = defaultLogDBMaxConns
+	if v := getenv("logDBMaxOpenConns"); v != "" {
+		c.logDB.MaxOpenConns, err = strconv.Atoi(v)
+		if err != nil || c.logDB.MaxOpenConns <= 0 {
+			return nil, errors.New("日志数据库最大连接数无效")
+		}
+	}
+	c.logDB.MaxIdleConns = defaultLogDBMaxConns
+	if v := getenv("logDBMaxIdleConns"); v != "" {
+		c.logDB.MaxIdleConns, err = strconv.Atoi(v)
+		if err != nil || c.logDB.MaxIdleConns < 0 {
+			return nil, errors.New("日志数据库最大空闲连接数无效")
+		}
+	}
+	c.logDB.ConnMaxLifetime = defaultLogDBConnMaxLifetime * time.Second
+	if v := getenv("logDBConnMaxLifetime"); v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil || seconds < 0 {
+			return nil, errors.New("日志数据库连接存活时间无效")
+		}
+		c.logDB.ConnMaxLifetime = time.Duration(seconds) * time.Second
+	}
+	c.logDBMaxBackoff = logdb.DefaultMaxBackoff
+	if v := getenv("logDBMaxBackoff"); v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil || seconds <= 0 {
+			return nil, errors.New("日志库重连间隔上限无效")
+		}
+		c.logDBMaxBackoff = time.Duration(seconds) * time.Second
+	}
+	c.logDBOutageNotify = logdb.DefaultOutageNotify
+	if v := getenv("logDBOutageNotify"); v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil || seconds <= 0 {
+			return nil, errors.New("日志库不可用通知阈值无效")
+		}
+		c.logDBOutageNotify = time.Duration(seconds) * time.Second
+	}
+	if v := getenv("notifyWebhook"); v != "" {
+		c.notifier = &notify.Webhook{URL: v, Template: getenv("notifyTemplate")}
+	}
+	c.criticalRegisterCount, err = strconv.Atoi(getenv("criticalRegisterCount"))
+	if err != nil || c.criticalRegisterCount <= 0 {
+		return nil, errors.New("注册人数临界值无效")
+	}
+	c.criticalRechargeCount, err = strconv.Atoi(getenv("criticalRechargeCount"))
+	if err != nil || c.criticalRechargeCount <= 0 {
+		return nil, errors.New("付费人数临界值无效")
+	}
+	c.criticalMoney, err = strconv.Atoi(getenv("criticalMoney"))
+	if err != nil || c.criticalMoney <= 0 {
+		return nil, errors.New("付费金额临界值无效")
+	}
+	c.onlineSource = getenv("onlineSource")
+	if c.onlineSource != "" {
+		if !online.ValidSource(c.onlineSource) {
+			return nil, errors.New("在线人数来源只支持 sql 或 http")
+		}
+		c.onlineSQL = getenv("onlineSql")
+		c.onlineURL = getenv("onlineURL")
+		c.onlineField = getenv("onlineField")
+		if c.onlineSource == online.SourceSQL && c.onlineSQL == "" {
+			return nil, errors.New("在线人数来源为 sql 时必须配置 onlineSql")
+		}
+		if c.onlineSource == online.SourceHTTP && c.onlineURL == "" {
+			return nil, errors.New("在线人数来源为 http 时必须配置 onlineURL")
+		}
+		if v := getenv("criticalOnline"); v != "" {
+			c.criticalOnline, err = strconv.Atoi(v)
+			if err != nil || c.criticalOnline < 0 {
+				return nil, errors.New("在线人数临界值无效")
+			}
+		}
+	}
+	c.sleepInterval, err = strconv.Atoi(getenv("sleepInterval"))
+	if err != nil || c.sleepInterval < 0 {
+		return nil, errors.New("休眠间隔无效")
+	}
+	c.installExamples.thread, err = strconv.Atoi(getenv("thread"))
+	if err != nil || c.installExamples.thread < 0 {
+		return nil, errors.New("线程数无效")
+	}
+	c.installExamples.zk1Port, err = strconv.Atoi(getenv("zk1Port"))
+	if err != nil || c.installExamples.zk1Port < 0 {
+		return nil, errors.New("zk1端口无效")
+	}
+	c.installExamples.zk2Port, err = strconv.Atoi(getenv("zk2Port"))
+	if err != nil || c.installExamples.zk2Port < 0 {
+		return nil, errors.New("zk2端口无效")
+	}
+	c.installExamples.zk3Port, err = strconv.Atoi(getenv("zk3Port"))
+	if err != nil || c.installExamples.zk3Port < 0 {
+		return nil, errors.New("zk3端口无效")
+	}
+	c.rateWindow, err = rateWindowEnv(getenv)
+	if err != nil {
+		return nil, err
+	}
+	if v := getenv("rateTrigger"); v != "" {
+		minutes, err := strconv.Atoi(v)
+		if err != nil || minutes < 0 {
+			return nil, errors.New("注册速率触发时间无效")
+		}
+		c.rateTrigger = time.Duration(minutes) * time.Minute
+	}
+	c.runLogKeep = defaultRunLogKeep
+	if v := getenv("runLogKeep"); v != "" {
+		c.runLogKeep, err = strconv.Atoi(v)
+		if err != nil || c.runLogKeep < 0 {
+			return nil, errors.New("运行日志保留数量无效")
+		}
+	}
+	c.preflightMinFreeMB = defaultMinFreeMB
+	if v := getenv("preflightMinFreeMB"); v != "" {
+		c.preflightMinFreeMB, err = strconv.Atoi(v)
+		if err != nil || c.preflightMinFreeMB < 0 {
+			return nil, errors.New("开服前检查最小剩余空间无效")
+		}
+	}
+	if v := getenv("prewarmPercent"); v != "" {
+		c.prewarmPercent, err = strconv.Atoi(v)
+		if err != nil || c.prewarmPercent < 0 || c.prewarmPercent >= 100 {
+			return nil, errors.New("预装阈值百分比无效，取值 0-99")
+		}
+	}
+	if v := getenv("gameDBProvision"); v != "" {
+		c.gameDBProvision, err = strconv.ParseBool(v)
+		if err != nil {
+			return nil, errors.New("gameDBProvision 只支持 true 或 false")
+		}
+	}
+	c.loginParallel = defaultLoginParallel
+	if v := getenv("loginParallel"); v != "" {
+		c.loginParallel, err = strconv.Atoi(v)
+		if err != nil || c.loginParallel <= 0 {
+			return nil, errors.New("登录服并发数无效")
+		}
+	}
+	c.loginQuorum = execute.QuorumAll
+	if v := getenv("loginQuorum"); v != "" {
+		c.loginQuorum = v
+	}
+	if !execute.ValidQuorum(c.loginQuorum) {
+		return nil, errors.New("登录服更新策略只支持 all 或 majority")
+	}
+	c.loginReload = loginreload.MethodPlaybook
+	if v := getenv("loginReload"); v != "" {
+		c.loginReload = v
+	}
+	if !loginreload.ValidMethod(c.loginReload) {
+		return nil, errors.New("登录服重载方式只支持 playbook 或 admin")
+	}
+	if c.loginReload == loginreload.MethodAdmin {
+		for _, endpoint := range strings.Split(getenv("loginAdminEndpoints"), ",") {
+			if endpoint = strings.TrimSpace(endpoint); endpoint != "" {
+				c.loginAdminEndpoints = append(c.loginAdminEndpoints, endpoint)
+			}
+		}
+		if len(c.loginAdminEndpoints) == 0 {
+			return nil, errors.New("登录服重载方式为 admin 时必须配置 loginAdminEndpoints")
+		}
+		c.loginAdminCommand = getenv("loginAdminCommand")
+		if c.loginAdminCommand == "" {
+			c.loginAdminCommand = "reload"
+		}
+		c.loginAdminAck = getenv("loginAdminAck")
+	}
+	if v := getenv("serverListURL"); v != "" {
+		c.serverList = &cdn.ServerList{
+			URL:       v,
+			IDField:   getenv("serverListIDField"),
+			IPField:   getenv("serverListIPField"),
+			PortField: getenv("serverListPortField"),
+			Auth:      cdn.Auth{CAFile: getenv("serverListCAFile")},
+		}
+		if c.serverList.IDField == "" {
+			c.serverList.IDField = "zone_id"
+		}
+		if t := getenv("serverListTimeout"); t != "" {
+			seconds, err := strconv.Atoi(t)
+			if err != nil || seconds <= 0 {
+				return nil, errors.New("区服列表验证超时时间无效")
+			}
+			c.serverList.Timeout = time.Duration(seconds) * time.Second
+		}
+	}
+	c.portStrategy = portalloc.StrategyNum
+	if v := getenv("portStrategy"); v != "" {
+		c.portStrategy = v
+	}
+	if !portalloc.ValidStrategy(c.portStrategy) {
+		return nil, errors.New("端口分配策略只支持 num、index 或 explicit")
+	}
+	c.portBase = defaultPortBase
+	if v := getenv("portBase"); v != "" {
+		c.portBase, err = strconv.Atoi(v)
+		if err != nil || c.portBase <= 0 {
+			return nil, errors.New("端口基数无效")
+		}
+	}
+	c.portStep = defaultPortStep
+	if v := getenv("portStep"); v != "" {
+		c.portStep, err = strconv.Atoi(v)
+		if err != nil || c.portStep <= 0 {
+			return nil, errors.New("端口步长无效")
+		}
+	}
+	c.installExamples.gameIndexNum, err = strconv.Atoi(getenv("gameIndexNum"))
+	if err != nil || c.installExamples.gameIndexNum < 0 {
+		return nil, errors.New("gameIndexNum无效")
+	}
+
+	if c.loginListFilePath == "" || c.logDB.Host == "" || c.logDB.User == "" ||
+		c.logDB.Password == "" || c.logDB.Name == "" || c.installExamples.domain == "" || c.installExamples.payNotifyUrl == "" ||
+		c.installExamples.zk1IP == "" || c.installExamples.zk2IP == "" || c.installExamples.zk3IP == "" ||
+		c.installExamples.gameDBHost == "" || c.installExamples.gameDBUser == "" || c.installExamples.gameDBPassword == "" {
+		return nil, errors.New("环境变量配置不齐全，请检查环境变量")
+	}
+
+	if c.artifactPin != "" && c.releasePackage != "" {
+		return nil, errors.New("artifactPin 和 releasePackage 只能配置一个")
+	}
+	if c.workMode != "auto" && c.workMode != "manual" {
+		return nil, errors.New("工作模式只支持 auto 或 manual")
+	}
+	if net.ParseIP(c.installExamples.gameDBHost) == nil {
+		return nil, errors.New("game数据库IP地址格式不正确")
+	}
+
+	return c, nil
+}
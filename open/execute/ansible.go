@@ -0,0 +1,298 @@
+package execute
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"open/redact"
+	"open/runlog"
+)
+
+// HostResult 是 json callback 中单个主机在某个任务上的执行结果。
+type HostResult struct {
+	Changed     bool        `json:"changed"`
+	Failed      bool        `json:"failed"`
+	Unreachable bool        `json:"unreachable"`
+	Skipped     bool        `json:"skipped"`
+	Msg         interface{} `json:"msg"`
+	Rc          *int        `json:"rc"`
+	Stdout      string      `json:"stdout"`
+	Stderr      string      `json:"stderr"`
+}
+
+// Status 返回主机结果的状态：ok、changed、failed、unreachable 或 skipped。
+func (h HostResult) Status() string {
+	switch {
+	case h.Unreachable:
+		return "unreachable"
+	case h.Failed:
+		return "failed"
+	case h.Skipped:
+		return "skipped"
+	case h.Changed:
+		return "changed"
+	default:
+		return "ok"
+	}
+}
+
+// Message 返回主机结果中的 msg，为空时退回 stderr。
+func (h HostResult) Message() string {
+	var msg string
+	switch v := h.Msg.(type) {
+	case nil:
+	case string:
+		msg = v
+	default:
+		b, _ := json.Marshal(v)
+		msg = string(b)
+	}
+	if (msg == "" || msg == "non-zero return code") && h.Stderr != "" {
+		msg = strings.TrimSpace(h.Stderr)
+	}
+	return msg
+}
+
+// TaskResult 是单个任务在所有主机上的执行结果。
+type TaskResult struct {
+	Name  string                `json:"name"`
+	Hosts map[string]HostResult `json:"hosts"`
+}
+
+// HostStats 是 json callback 中 stats 部分的主机汇总。
+type HostStats struct {
+	Ok          int `json:"ok"`
+	Changed     int `json:"changed"`
+	Failures    int `json:"failures"`
+	Unreachable int `json:"unreachable"`
+	Skipped     int `json:"skipped"`
+	Ignored     int `json:"ignored"`
+}
+
+// PlaybookResult 是一次 ansible / ansible-playbook 调用解析后的结构化结果。
+type PlaybookResult struct {
+	Tasks []TaskResult
+	Stats map[string]HostStats
+}
+
+// AnsibleError 描述 ansible 调用失败时出错的任务、主机和信息。
+type AnsibleError struct {
+	Step        string
+	Task        string
+	Host        string
+	Msg         string
+	Rc          *int
+	Unreachable bool
+	Err         error
+}
+
+func (e *AnsibleError) Error() string {
+	if e.Task == "" {
+		return fmt.Sprintf("步骤 %s 执行失败: %v", e.Step, e.Err)
+	}
+	state := "失败"
+	if e.Unreachable {
+		state = "不可达"
+	}
+	s := fmt.Sprintf("任务 [%s] 在 %s 上%s: %s", e.Task, e.Host, state, e.Msg)
+	if e.Rc != nil {
+		s += fmt.Sprintf(" (rc=%d)", *e.Rc)
+	}
+	return s
+}
+
+func (e *AnsibleError) Unwrap() error {
+	return e.Err
+}
+
+// AsAnsibleError 从错误链中取出 *AnsibleError，不存在时返回 nil。
+func AsAnsibleError(err error) *AnsibleError {
+	var ae *AnsibleError
+	if errors.As(err, &ae) {
+		return ae
+	}
+	return nil
+}
+
+// LastFailure 返回最后一个失败或不可达的任务结果。
+// 带 ignore_errors 的任务失败后剧本会继续执行，致命失败总是最后一个。
+func (r *PlaybookResult) LastFailure() (task, host string, result HostResult, ok bool) {
+	for i := len(r.Tasks) - 1; i >= 0; i-- {
+		hosts := make([]string, 0, len(r.Tasks[i].Hosts))
+		for h := range r.Tasks[i].Hosts {
+			hosts = append(hosts, h)
+		}
+		sort.Strings(hosts)
+		for _, h := range hosts {
+			hr := r.Tasks[i].Hosts[h]
+			if hr.Failed || hr.Unreachable {
+				return r.Tasks[i].Name, h, hr, true
+			}
+		}
+	}
+	return "", "", HostResult{}, false
+}
+
+// Summary 返回按主机汇总的统计信息，用于主日志。
+func (r *PlaybookResult) Summary() string {
+	hosts := make([]string, 0, len(r.Stats))
+	for h := range r.Stats {
+		hosts = append(hosts, h)
+	}
+	sort.Strings(hosts)
+	parts := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		s := r.Stats[h]
+		parts = append(parts, fmt.Sprintf("%s ok=%d changed=%d failed=%d unreachable=%d skipped=%d",
+			h, s.Ok, s.Changed, s.Failures, s.Unreachable, s.Skipped))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// ParseResult 解析 json callback 的标准输出。
+// 参数:
+//
+//	output: ansible 的标准输出。
+//
+// 返回值:
+//
+//	*PlaybookResult: 解析后的结果。
+//	error: 如果输出不是合法的 json callback 格式，返回错误信息；否则返回 nil。
+func ParseResult(output []byte) (*PlaybookResult, error) {
+	start := bytes.IndexByte(output, '{')
+	if start < 0 {
+		return nil, errors.New("输出中没有 json 内容")
+	}
+
+	var raw struct {
+		Plays []struct {
+			Tasks []struct {
+				Task struct {
+					Name string `json:"name"`
+				} `json:"task"`
+				Hosts map[string]HostResult `json:"hosts"`
+			} `json:"tasks"`
+		} `json:"plays"`
+		Stats map[string]HostStats `json:"stats"`
+	}
+	if err := json.NewDecoder(bytes.NewReader(output[start:])).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("解析 ansible json 输出失败: %v", err)
+	}
+
+	result := &PlaybookResult{Stats: raw.Stats}
+	for _, play := range raw.Plays {
+		for _, task := range play.Tasks {
+			result.Tasks = append(result.Tasks, TaskResult{Name: task.Task.Name, Hosts: task.Hosts})
+		}
+	}
+	return result, nil
+}
+
+// RunAnsible 以 json callback 执行 ansible 或 ansible-playbook，并解析每个主机每个任务的结果。
+// 参数:
+//
+//	run: 本次运行对象，原始输出写入其步骤日志文件。
+//	step: 步骤名称。
+//	name: 可执行文件名，ansible 或 ansible-playbook。
+//	args: 命令行参数。
+//
+// 返回值:
+//
+//	*PlaybookResult: 解析后的结果，输出无法解析时为 nil。
+//	error: 如果命令执行失败，返回 *AnsibleError；否则返回 nil。
+func RunAnsible(run *runlog.Run, step, name string, args ...string) (*PlaybookResult, error) {
+	cmd := exec.Command(name, args...)
+	// 子进程环境中去掉密钥，ansible 不需要日志库和 game 数据库的密码
+	cmd.Env = append(redact.Env(os.Environ()),
+		"ANSIBLE_STDOUT_CALLBACK=json",
+		"ANSIBLE_LOAD_CALLBACK_PLUGINS=1")
+
+	output, err := run.Exec(step, cmd)
+	result, parseErr := ParseResult(output)
+	if parseErr != nil {
+		warnLogger.Printf("步骤 %s: %v", step, parseErr)
+	} else {
+		infoLogger.Printf("步骤 %s 结果: %s", step, result.Summary())
+	}
+	if err == nil {
+		return result, nil
+	}
+
+	ae := &AnsibleError{Step: step, Err: err}
+	if result != nil {
+		if task, host, hr, ok := result.LastFailure(); ok {
+			ae.Task = task
+			ae.Host = host
+			ae.Msg = hr.Message()
+			ae.Rc = hr.Rc
+			ae.Unreachable = hr.Unreachable
+		}
+	}
+	return result, ae
+}
+
+// Adhoc 对多个主机执行 ansible 临时命令，返回每个主机的错误，nil 表示成功。
+// 参数:
+//
+//	run: 本次运行对象。
+//	step: 步骤名称。
+//	hosts: 目标主机列表。
+//	module: ansible 模块名。
+//	args: 模块参数，为空时不传 -a。
+//
+// 返回值:
+//
+//	map[string]error: 每个主机的执行结果。
+func Adhoc(run *runlog.Run, step string, hosts []string, module, args string) map[string]error {
+	_, errs := AdhocOutput(run, step, hosts, module, args)
+	return errs
+}
+
+// AdhocOutput 与 Adhoc 相同，同时返回每个主机的标准输出。
+// 参数:
+//
+//	run: 本次运行对象。
+//	step: 步骤名称。
+//	hosts: 目标主机列表。
+//	module: ansible 模块名，需返回 stdout，例如 shell、command。
+//	args: 模块参数，为空时不传 -a。
+//
+// 返回值:
+//
+//	map[string]string: 每个成功主机的标准输出。
+//	map[string]error: 每个主机的执行结果。
+func AdhocOutput(run *runlog.Run, step string, hosts []string, module, args string) (map[string]string, map[string]error) {
+	cmdArgs := []string{"-i", strings.Join(hosts, ",") + ",", "all", "-m", module}
+	if args != "" {
+		cmdArgs = append(cmdArgs, "-a", args)
+	}
+	result, err := RunAnsible(run, step, "ansible", cmdArgs...)
+
+	outputs := make(map[string]string, len(hosts))
+	errs := make(map[string]error, len(hosts))
+	for _, host := range hosts {
+		if result == nil || len(result.Tasks) == 0 {
+			errs[host] = err
+			continue
+		}
+		hr, ok := result.Tasks[0].Hosts[host]
+		switch {
+		case !ok:
+			errs[host] = fmt.Errorf("无执行结果")
+		case hr.Unreachable:
+			errs[host] = fmt.Errorf("不可达: %s", hr.Message())
+		case hr.Failed:
+			errs[host] = fmt.Errorf("%s", hr.Message())
+		default:
+			errs[host] = nil
+			outputs[host] = hr.Stdout
+		}
+	}
+	return outputs, errs
+}
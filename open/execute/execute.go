@@ -3,23 +3,28 @@ package execute
 import (
 	"database/sql"
 	"fmt"
-	"github.com/a8m/envsubst"
 	"open/getsomething"
+	"open/layout"
 	"open/loglevel"
+	"open/render"
+	"open/runlog"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strconv"
 	"time"
 )
 
-const basePort = 12000
-
 var (
 	infoLogger    = loglevel.GetInfoLogger()
 	successLogger = loglevel.GetSuccessLogger()
+	warnLogger    = loglevel.GetWarnLogger()
 )
 
+// GameConfigDir 返回本次运行中指定 game 编号的配置文件生成目录，运行目录会被保留，只用于不含密钥的 open_time.lua。
+func GameConfigDir(run *runlog.Run, num int) string {
+	return filepath.Join(run.Dir, fmt.Sprintf("config-game%d", num))
+}
+
 // UpdateServerNum 更新 init.txt 文件中的 game 编号。
 // 参数:
 //
@@ -40,28 +45,27 @@ func UpdateServerNum(num int, initFilePath string) error {
 // CleanLogs 清理指定 game 编号的日志。
 // 参数:
 //
+//	run: 本次运行对象，ansible 输出写入其步骤日志文件。
+//	lay: 目标机目录结构，路径通过 extra-vars 传给 playbook。
 //	num: 要清理日志的 game 编号。
 //	ipMap: IP 地址到 game 编号列表的映射表。
 //
 // 返回值:
 //
 //	error: 如果获取 IP 或清理日志失败，返回错误信息；否则返回 nil。
-func CleanLogs(num int, ipMap map[string][]string) error {
+func CleanLogs(run *runlog.Run, lay layout.Layout, num int, ipMap map[string][]string) error {
 	ip, err := getsomething.GetGameIP(num, ipMap)
 	if err != nil {
 		return err
 	}
 
 	infoLogger.Printf("正在清理日志, game 编号为:%d IP:%s", num, ip)
-	cmd := exec.Command("ansible", "-i", fmt.Sprintf("%s,", ip),
+	_, err = RunAnsible(run, fmt.Sprintf("clean-logs-game%d", num), "ansible", "-i", fmt.Sprintf("%s,", ip),
 		"all",
 		"-m", "shell",
-		"-a", fmt.Sprintf("path=/data/server%d/game/log/ state=absent recurse=yes", num))
-
-	output, err := cmd.CombinedOutput()
-	infoLogger.Printf("ansible输出:\n%s\n", output)
+		"-a", fmt.Sprintf("path=%s/log/ state=absent recurse=yes", lay.GameDirOf(num)))
 	if err != nil {
-		return fmt.Errorf("ansible 清理日志失败: %v\n", err)
+		return fmt.Errorf("ansible 清理日志失败: %w", err)
 	}
 	return nil
 }
@@ -79,41 +83,27 @@ func UpdateSleepTime(i int) error {
 	return nil
 }
 
-// UpdateWhitelist 更新指定 game 编号的白名单并重载登录服务。
+// ReloadLogin 重载单个登录服上的所有 login 实例，使白名单和限制名单生效。
 // 参数:
 //
-//	num: 要更新的 game 编号。
-//	loginSlice: 登录服务器 IP 列表。
-//	whitePath: 白名单文件在被控节点路径。
+//	run: 本次运行对象，ansible 输出写入其步骤日志文件。
+//	lay: 目标机目录结构，路径通过 extra-vars 传给 playbook。
+//	num: 本次操作的 game 编号。
+//	loginIP: 登录服务器 IP。
 //	loginBookPath: Ansible playbook 文件路径，用于重载登录服务。
 //
 // 返回值:
 //
-//	error: 如果更新白名单或重载登录服务失败，返回错误信息；否则返回 nil。
-func UpdateWhitelist(num int, loginSlice []string, whitePath, loginBookPath string) error {
-	fmt.Printf("白名单路径为: %s\n", whitePath)
-	for _, loginIP := range loginSlice {
-		infoLogger.Printf("正在更新白名单, game 编号为:%d 当前IP为:%s", num, loginIP)
-		cmd := exec.Command("ansible", "-i", fmt.Sprintf("%s,", loginIP),
-			"all",
-			"-m", "shell",
-			"-a", fmt.Sprintf("sed -i -e '/^%d$/d' -e '/^$/d' %s", num, whitePath))
-		output, err := cmd.CombinedOutput()
-		infoLogger.Printf("ansible输出:\n%s\n", output)
-		if err != nil {
-			return fmt.Errorf("ansible 更新白名单失败: %v\n", err)
-		}
-
-		infoLogger.Printf("正在 reload login 当前IP为:%s", loginIP)
-		cmd = exec.Command("ansible-playbook",
-			"-i", fmt.Sprintf("%s,", loginIP),
-			"-e", fmt.Sprintf("host_name=%s,", loginIP),
-			loginBookPath)
-		output, err = cmd.CombinedOutput()
-		infoLogger.Printf("ansible输出:\n%s\n", output)
-		if err != nil {
-			return fmt.Errorf("ansible reload login失败: %v\n", err)
-		}
+//	error: 如果重载登录服务失败，返回错误信息；否则返回 nil。
+func ReloadLogin(run *runlog.Run, lay layout.Layout, num int, loginIP, loginBookPath string) error {
+	infoLogger.Printf("正在 reload login 当前IP为:%s", loginIP)
+	_, err := RunAnsible(run, fmt.Sprintf("reload-login-%s", loginIP), "ansible-playbook",
+		"-i", fmt.Sprintf("%s,", loginIP),
+		"-e", fmt.Sprintf("host_name=%s,", loginIP),
+		"-e", lay.ExtraVars(num),
+		loginBookPath)
+	if err != nil {
+		return fmt.Errorf("ansible reload login失败: %w", err)
 	}
 	return nil
 }
@@ -121,6 +111,8 @@ func UpdateWhitelist(num int, loginSlice []string, whitePath, loginBookPath stri
 // UpdateOpenTime 设置指定 game 编号的开服时间。
 // 参数:
 //
+//	run: 本次运行对象，ansible 输出写入其步骤日志文件。
+//	lay: 目标机目录结构，路径通过 extra-vars 传给 playbook。
 //	num: 要设置开服时间的 game 编号。
 //	ipMap: IP 地址到 game 编号列表的映射表。
 //	openBookPath: Ansible playbook 文件路径，用于设置开服时间。
@@ -128,100 +120,80 @@ func UpdateWhitelist(num int, loginSlice []string, whitePath, loginBookPath stri
 // 返回值:
 //
 //	error: 如果获取 IP 或设置开服时间失败，返回错误信息；否则返回 nil。
-func UpdateOpenTime(num int, ipMap map[string][]string, openBookPath string) error {
+func UpdateOpenTime(run *runlog.Run, lay layout.Layout, num int, ipMap map[string][]string, openBookPath string) error {
 	ip, err := getsomething.GetGameIP(num, ipMap)
 	if err != nil {
 		return err
 	}
 
+	configDir := GameConfigDir(run, num)
+	if err = render.WriteOpenTime(configDir, time.Now()); err != nil {
+		return fmt.Errorf("开服时间文件生成失败: %v", err)
+	}
+
 	infoLogger.Printf("正在设置开服时间 game 编号为: %d 当前IP为:%s", num, ip)
-	cmd := exec.Command("ansible-playbook", "-i", fmt.Sprintf("%s,", ip),
+	_, err = RunAnsible(run, fmt.Sprintf("open-time-game%d", num), "ansible-playbook", "-i", fmt.Sprintf("%s,", ip),
 		"-e", fmt.Sprintf("host_name=%s", ip),
 		"-e", fmt.Sprintf("area_id=%d", num),
+		"-e", fmt.Sprintf("open_time_file=%s", filepath.Join(configDir, render.OpenTimeFileName)),
+		"-e", lay.ExtraVars(num),
 		openBookPath)
-
-	output, err := cmd.CombinedOutput()
-	infoLogger.Printf("ansible输出:\n%s\n", output)
 	if err != nil {
-		return fmt.Errorf("ansible 更新开服时间失败: %v\n", err)
-	}
-	return nil
-}
-
-// UpdateLimit 更新指定 game 编号的限制名单并重载登录服务。
-// 参数:
-//
-//	num: 要更新限制名单的 game 编号。
-//	loginSlice: 登录服务器 IP 列表。
-//	loginListFilePath: 限制名单文件路径。
-//	limitBookPath: Ansible playbook 文件完整路径，用于更新限制名单。
-//	loginBookPath: Ansible playbook 文件完整路径，用于重载登录服务。
-//
-// 返回值:
-//
-//	error: 如果更新限制名单或重载登录服务失败，返回错误信息；否则返回 nil。
-func UpdateLimit(num int, loginSlice []string, loginListFilePath, limitBookPath, loginBookPath string) error {
-	for _, loginIP := range loginSlice {
-		infoLogger.Printf("正在更新限制名单 服务:%d IP:%s", num, loginIP)
-		cmd := exec.Command("ansible-playbook", "-i", fmt.Sprintf("%s,", loginIP),
-			"-e", fmt.Sprintf("host_name=%s,", loginIP),
-			"-e", fmt.Sprintf("area_id=%d", num),
-			"-e", fmt.Sprintf("list_path=%s", loginListFilePath),
-			limitBookPath)
-
-		output, err := cmd.CombinedOutput()
-		infoLogger.Printf("ansible输出:\n%s\n", output)
-		if err != nil {
-			return fmt.Errorf("ansible 更新限制名单失败: %v\n", err)
-		}
-		infoLogger.Printf("正在reload login 当前IP为:%s", loginIP)
-		cmd = exec.Command("ansible-playbook",
-			"-i", fmt.Sprintf("%s,", loginIP),
-			"-e", fmt.Sprintf("host_name=%s,", loginIP),
-			loginBookPath)
-		output, err = cmd.CombinedOutput()
-		infoLogger.Printf("ansible输出:\n%s\n", output)
-		if err != nil {
-			return fmt.Errorf("ansible reload login失败: %v\n", err)
-		}
+		return fmt.Errorf("ansible 更新开服时间失败: %w", err)
 	}
 	return nil
 }
 
-// InstallGame 从旧 game 拉取安装包并部署到新 game。
+// FetchPackage 在旧 game 上打包当前版本并拉取到本地。
 // 参数:
 //
+//	run: 本次运行对象，ansible 输出写入其步骤日志文件。
+//	lay: 目标机目录结构，路径通过 extra-vars 传给 playbook。
 //	oldNum: 旧 game 编号，用于拉取安装包。
-//	newNum: 新 game 编号，用于部署。
-//	bookPath: Ansible playbook 文件所在目录。
-//	packageYamlName: 拉取安装包的 playbook 文件名。
-//	installYamlName: 部署安装的 playbook 文件名。
+//	packageBookPath: 拉取安装包的 playbook 文件完整路径。
 //	ipMap: IP 地址到 game 编号列表的映射表。
-//	ipGroup: IP 地址到 group ID 的映射表。
 //
 // 返回值:
 //
-//	error: 如果拉取安装包、获取 IP、生成模板或部署失败，返回错误信息；否则返回 nil。
-func InstallGame(oldNum, newNum int,
-	bookPath, packageYamlName, installYamlName string,
-	ipMap map[string][]string, ipGroup map[string]int) error {
+//	string: 拉取到本地的安装包路径，位于本次运行目录中，多个项目同时开服时互不覆盖。
+//	error: 如果获取 IP 或拉取安装包失败，返回错误信息；否则返回 nil。
+func FetchPackage(run *runlog.Run, lay layout.Layout, oldNum int, packageBookPath string, ipMap map[string][]string) (string, error) {
 	oldIP, err := getsomething.GetGameIP(oldNum, ipMap)
 	if err != nil {
-		return err
+		return "", err
 	}
 
+	packageFile := filepath.Join(run.Dir, "install.tar.gz")
 	infoLogger.Printf("正在从 game 编号为:%d 拉取最新安装包, IP 为:%s", oldNum, oldIP)
-	cmd := exec.Command("ansible-playbook", "-i", fmt.Sprintf("%s,", oldIP),
+	_, err = RunAnsible(run, fmt.Sprintf("package-game%d", oldNum), "ansible-playbook", "-i", fmt.Sprintf("%s,", oldIP),
 		"-e", fmt.Sprintf("host_name=%s", oldIP),
 		"-e", fmt.Sprintf("area_id=%d", oldNum),
-		filepath.Join(bookPath, packageYamlName))
-
-	output, err := cmd.CombinedOutput()
-	infoLogger.Printf("ansible输出:\n%s\n", output)
+		"-e", fmt.Sprintf("package_file=%s", packageFile),
+		"-e", lay.ExtraVars(oldNum),
+		packageBookPath)
 	if err != nil {
-		return fmt.Errorf("ansible 拉取最新安装包失败: %v\n", err)
+		return "", fmt.Errorf("ansible 拉取最新安装包失败: %w", err)
 	}
+	return packageFile, nil
+}
 
+// InstallGame 使用指定安装包部署新 game。
+// 参数:
+//
+//	run: 本次运行对象，ansible 输出写入其步骤日志文件。
+//	lay: 目标机目录结构，路径通过 extra-vars 传给 playbook。
+//	newNum: 新 game 编号，用于部署。
+//	packageFile: 本地安装包路径，调用方负责在部署前完成校验。
+//	installBookPath: 部署安装的 playbook 文件完整路径。
+//	ipMap: IP 地址到 game 编号列表的映射表。
+//	ipGroup: IP 地址到 group ID 的映射表。
+//	cfg: game 配置，端口由调用方按分配策略填入，IP、组编号、区域编号和数据库名由本函数填充。
+//
+// 返回值:
+//
+//	error: 如果获取 IP、生成配置或部署失败，返回错误信息；否则返回 nil。
+func InstallGame(run *runlog.Run, lay layout.Layout, newNum int, packageFile, installBookPath string,
+	ipMap map[string][]string, ipGroup map[string]int, cfg render.GameConfig) error {
 	newIP, err := getsomething.GetGameIP(newNum, ipMap)
 	if err != nil {
 		return err
@@ -231,55 +203,33 @@ func InstallGame(oldNum, newNum int,
 	if err != nil {
 		return err
 	}
-	if err = CreateVarTemplate(bookPath, newIP, newNum, basePort+newNum, groupID); err != nil {
-		return fmt.Errorf("install 模板文件生成失败: %v", err)
-	}
-
-	infoLogger.Printf("正在部署 game 编号为:%d, IP 为:%s", newNum, newIP)
-	cmd = exec.Command("ansible-playbook", "-i", fmt.Sprintf("%s,", newIP),
-		"-e", fmt.Sprintf("host_name=%s", newIP),
-		filepath.Join(bookPath, installYamlName))
-	output, err = cmd.CombinedOutput()
-	infoLogger.Printf("ansible输出:\n%s\n", output)
+	cfg.IP = newIP
+	cfg.GroupID = groupID
+	cfg.AreaID = newNum
+	cfg.GameDB.Name = lay.DBName(newNum)
+	// 配置文件包含 game 数据库密码，生成到临时目录，部署结束后删除，不留在保留的运行目录中
+	configDir, err := os.MkdirTemp("", fmt.Sprintf("config-game%d-", newNum))
 	if err != nil {
-		return fmt.Errorf("ansible 部署失败: %v\n", err)
+		return fmt.Errorf("创建配置目录失败: %v", err)
 	}
-	return nil
-}
-
-// CreateVarTemplate 生成 Ansible 的变量模板文件。
-// 参数:
-//
-//	bookPath: 模板文件所在目录。
-//	currentIP: 当前服务器 IP 地址。
-//	areaID: game 区域 ID。
-//	gamePort: game 服务端口号。
-//	groupID: group ID。
-//
-// 返回值:
-//
-//	error: 如果读取或写入模板文件失败，返回错误信息；否则返回 nil。
-func CreateVarTemplate(bookPath string, currentIP string, areaID, gamePort, groupID int) error {
-	// 输入和输出文件路径
-	inputFile := filepath.Join(bookPath, "vars", "main.yaml.tmp")
-	outputFile := filepath.Join(bookPath, "vars", "main.yaml")
-
-	os.Setenv("currentIP", currentIP)
-	os.Setenv("gamePort", strconv.Itoa(gamePort))
-	os.Setenv("gameDBName", fmt.Sprintf("cbt4_game_%d", areaID))
-	os.Setenv("groupID", strconv.Itoa(groupID))
-	os.Setenv("areaID", strconv.Itoa(areaID))
-
-	// 读取文件并替换环境变量
-	content, err := envsubst.ReadFile(inputFile)
-	if err != nil {
-		return fmt.Errorf("读取文件失败:%v", err)
+	defer os.RemoveAll(configDir)
+	if err = render.WriteGameConfig(configDir, cfg, time.Now()); err != nil {
+		return fmt.Errorf("game 配置文件生成失败: %v", err)
+	}
+	if err = render.ValidateGameConfig(configDir, newNum); err != nil {
+		return fmt.Errorf("game 配置文件校验失败: %v", err)
 	}
 
-	// 写入文件
-	err = os.WriteFile(outputFile, content, 0644)
+	infoLogger.Printf("正在部署 game 编号为:%d, IP 为:%s", newNum, newIP)
+	_, err = RunAnsible(run, fmt.Sprintf("install-game%d", newNum), "ansible-playbook", "-i", fmt.Sprintf("%s,", newIP),
+		"-e", fmt.Sprintf("host_name=%s", newIP),
+		"-e", fmt.Sprintf("area_id=%d", newNum),
+		"-e", fmt.Sprintf("config_dir=%s", configDir),
+		"-e", fmt.Sprintf("package_file=%s", packageFile),
+		"-e", lay.ExtraVars(newNum),
+		installBookPath)
 	if err != nil {
-		return fmt.Errorf("写入文件失败:%v", err)
+		return fmt.Errorf("ansible 部署失败: %w", err)
 	}
 	return nil
 }
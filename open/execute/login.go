@@ -0,0 +1,85 @@
+package execute
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 登录服更新策略
+const (
+	QuorumAll      = "all"      // 所有登录服都成功才算成功
+	QuorumMajority = "majority" // 超过半数成功即算成功，失败的登录服在下一轮循环中补齐
+)
+
+// LoginResults 每个登录服的执行结果，值为 nil 表示成功。
+type LoginResults map[string]error
+
+// Failed 返回失败的登录服，按 IP 排序。
+func (r LoginResults) Failed() []string {
+	var hosts []string
+	for host, err := range r {
+		if err != nil {
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// Check 按策略判断整体是否成功。
+// 参数:
+//
+//	policy: QuorumAll 或 QuorumMajority。
+//
+// 返回值:
+//
+//	error: 如果不满足策略，返回包含各失败登录服错误的信息；否则返回 nil。
+func (r LoginResults) Check(policy string) error {
+	failed := r.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+	if policy == QuorumMajority && (len(r)-len(failed))*2 > len(r) {
+		warnLogger.Printf("登录服 %s 更新失败, 已超过半数成功, 下一轮补齐", strings.Join(failed, ","))
+		return nil
+	}
+	msgs := make([]string, 0, len(failed))
+	for _, host := range failed {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", host, r[host]))
+	}
+	return fmt.Errorf("%d/%d 个登录服失败: %s", len(failed), len(r), strings.Join(msgs, "; "))
+}
+
+// ValidQuorum 判断策略名是否有效。
+func ValidQuorum(policy string) bool {
+	return policy == QuorumAll || policy == QuorumMajority
+}
+
+// ForEachLogin 并发对每个登录服执行 fn，同时执行的数量不超过 parallel，小于等于 0 时为 1。
+func ForEachLogin(hosts []string, parallel int, fn func(host string) error) LoginResults {
+	if parallel <= 0 {
+		parallel = 1
+	}
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, parallel)
+		results = make(LoginResults, len(hosts))
+	)
+	for _, host := range hosts {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(host string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			err := fn(host)
+			mu.Lock()
+			results[host] = err
+			mu.Unlock()
+		}(host)
+	}
+	wg.Wait()
+	return results
+}
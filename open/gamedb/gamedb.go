@@ -0,0 +1,256 @@
+package gamedb
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"open/loglevel"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// server.app.lua 的 game_db 不配置端口，与游戏服一致使用默认端口
+const dbPort = 3306
+
+const migrationTable = "open_schema_migrations"
+
+var (
+	infoLogger    = loglevel.GetInfoLogger()
+	successLogger = loglevel.GetSuccessLogger()
+
+	grantRegex = regexp.MustCompile("^GRANT (.+) ON (\\S+)\\.\\S+ TO ")
+	// 游戏服运行所需的最小权限
+	requiredPrivileges = []string{"SELECT", "INSERT", "UPDATE", "DELETE"}
+)
+
+// Options 数据库准备所需的参数。
+type Options struct {
+	Host          string
+	User          string // 游戏服使用的账号，用于校验权限
+	Password      string
+	AdminUser     string // 建库和执行迁移的账号，为空时使用 User
+	AdminPassword string
+	DBName        string
+	MigrationDir  string // 迁移 SQL 目录，按文件名顺序执行，为空或不存在时跳过
+}
+
+// Ping 检查数据库能否连接，name 为空时只检查数据库服务。
+// 参数:
+//
+//	user: 数据库用户。
+//	password: 数据库密码。
+//	host: 数据库地址。
+//	name: 数据库名。
+//
+// 返回值:
+//
+//	error: 如果连接失败，返回错误信息；否则返回 nil。
+func Ping(user, password, host, name string) error {
+	db, err := open(user, password, host, name, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.Ping()
+}
+
+// Provision 创建 game 数据库（不存在时），执行未执行过的迁移文件，并校验游戏服账号的权限。
+// 参数:
+//
+//	opts: 数据库准备参数。
+//
+// 返回值:
+//
+//	error: 如果建库、迁移或权限校验失败，返回错误信息；否则返回 nil。
+func Provision(opts Options) error {
+	adminUser, adminPassword := opts.AdminUser, opts.AdminPassword
+	if adminUser == "" {
+		adminUser, adminPassword = opts.User, opts.Password
+	}
+
+	infoLogger.Printf("正在准备 game 数据库 %s, 地址: %s", opts.DBName, opts.Host)
+	server, err := open(adminUser, adminPassword, opts.Host, "", false)
+	if err != nil {
+		return err
+	}
+	_, err = server.Exec(fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s` DEFAULT CHARACTER SET utf8mb4", opts.DBName))
+	server.Close()
+	if err != nil {
+		return fmt.Errorf("创建数据库 %s 失败: %v", opts.DBName, err)
+	}
+
+	if err = migrate(adminUser, adminPassword, opts.Host, opts.DBName, opts.MigrationDir); err != nil {
+		return err
+	}
+
+	if err = checkGrants(opts.User, opts.Password, opts.Host, opts.DBName); err != nil {
+		return fmt.Errorf("账号 %s 权限校验失败: %v", opts.User, err)
+	}
+	successLogger.Printf("game 数据库 %s 准备完成", opts.DBName)
+	return nil
+}
+
+// migrate 按文件名顺序执行 dir 下尚未执行的 .sql 文件，已执行的版本记录在 open_schema_migrations 表中。
+func migrate(user, password, host, name, dir string) error {
+	files, err := migrationFiles(dir)
+	if err != nil || len(files) == 0 {
+		return err
+	}
+
+	db, err := open(user, password, host, name, true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS " + migrationTable +
+		" (version VARCHAR(255) NOT NULL PRIMARY KEY, applied_at DATETIME NOT NULL)")
+	if err != nil {
+		return fmt.Errorf("创建迁移记录表失败: %v", err)
+	}
+
+	applied := make(map[string]bool)
+	rows, err := db.Query("SELECT version FROM " + migrationTable)
+	if err != nil {
+		return fmt.Errorf("查询迁移记录失败: %v", err)
+	}
+	for rows.Next() {
+		var version string
+		if err = rows.Scan(&version); err != nil {
+			rows.Close()
+			return fmt.Errorf("查询迁移记录失败: %v", err)
+		}
+		applied[version] = true
+	}
+	rows.Close()
+
+	for _, file := range files {
+		version := strings.TrimSuffix(filepath.Base(file), ".sql")
+		if applied[version] {
+			continue
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("读取迁移文件失败: %v", err)
+		}
+		if strings.TrimSpace(string(content)) != "" {
+			if _, err = db.Exec(string(content)); err != nil {
+				return fmt.Errorf("执行迁移 %s 失败: %v", version, err)
+			}
+		}
+		if _, err = db.Exec("INSERT INTO "+migrationTable+" (version, applied_at) VALUES (?, ?)", version, time.Now()); err != nil {
+			return fmt.Errorf("记录迁移 %s 失败: %v", version, err)
+		}
+		infoLogger.Printf("已执行迁移 %s", version)
+	}
+	return nil
+}
+
+func migrationFiles(dir string) ([]string, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, fmt.Errorf("读取迁移目录失败: %v", err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// checkGrants 以游戏服账号登录，确认其在 name 库上拥有所需权限。
+func checkGrants(user, password, host, name string) error {
+	db, err := open(user, password, host, name, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SHOW GRANTS FOR CURRENT_USER()")
+	if err != nil {
+		return fmt.Errorf("查询权限失败: %v", err)
+	}
+	defer rows.Close()
+
+	granted := make(map[string]bool)
+	for rows.Next() {
+		var line string
+		if err = rows.Scan(&line); err != nil {
+			return fmt.Errorf("查询权限失败: %v", err)
+		}
+		m := grantRegex.FindStringSubmatch(line)
+		if m == nil || !matchDB(m[2], name) {
+			continue
+		}
+		for _, p := range strings.Split(m[1], ",") {
+			granted[strings.ToUpper(strings.TrimSpace(p))] = true
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("查询权限失败: %v", err)
+	}
+
+	if granted["ALL PRIVILEGES"] || granted["ALL"] {
+		return nil
+	}
+	var missing []string
+	for _, p := range requiredPrivileges {
+		if !granted[p] {
+			missing = append(missing, p)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("在 %s 上缺少权限: %s", name, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// matchDB 判断 GRANT 语句中的库名（可能含 % _ 通配符）是否匹配 name。
+func matchDB(pattern, name string) bool {
+	pattern = strings.Trim(pattern, "`")
+	if pattern == "*" {
+		return true
+	}
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			expr.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		case c == '%':
+			expr.WriteString(".*")
+		case c == '_':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+	ok, _ := regexp.MatchString(expr.String(), name)
+	return ok
+}
+
+func open(user, password, host, name string, multiStatements bool) (*sql.DB, error) {
+	cfg := mysql.NewConfig()
+	cfg.User = user
+	cfg.Passwd = password
+	cfg.Net = "tcp"
+	cfg.Addr = net.JoinHostPort(host, strconv.Itoa(dbPort))
+	cfg.DBName = name
+	cfg.Timeout = 5 * time.Second
+	cfg.MultiStatements = multiStatements
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		return nil, fmt.Errorf("创建数据库对象失败: %v", err)
+	}
+	db.SetConnMaxLifetime(time.Minute)
+	return db, nil
+}
@@ -2,6 +2,8 @@ package getsomething
 
 import (
 	"bufio"
+	"crypto/tls"
+	"crypto/x509"
 	"database/sql"
 	"fmt"
 	"io"
@@ -12,6 +14,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/go-sql-driver/mysql"
 )
 
 var errLogger = loglevel.GetErrLogger()
@@ -141,6 +145,10 @@ func LoadIpMap(currentDir, gameListFileName string) (ipMap map[string][]string,
 
 		ip := parts[0]
 		numbers := strings.Split(parts[1][1:len(parts[1])-1], ",")
+		for i, n := range numbers {
+			// 去掉显式配置的端口，例如 1:3340
+			numbers[i], _, _ = strings.Cut(n, ":")
+		}
 		ipMap[ip] = numbers
 
 		groupID, err := strconv.Atoi(parts[2])
@@ -157,6 +165,51 @@ func LoadIpMap(currentDir, gameListFileName string) (ipMap map[string][]string,
 	return ipMap, ipGroup
 }
 
+// LoadPortMap 从 game_list.txt 文件加载显式配置的 game 端口，格式为 [编号:端口,...]。
+// 参数:
+//
+//	currentDir: 文件所在目录。
+//	gameListFileName: 包含 IP 和 game 编号列表的文件名。
+//
+// 返回值:
+//
+//	map[int]int: game 编号到端口的映射，未配置端口的编号不在其中。
+//
+// 如果文件操作失败，程序将通过 errLogger 记录错误并退出。
+func LoadPortMap(currentDir, gameListFileName string) map[int]int {
+	file, err := os.Open(filepath.Join(currentDir, gameListFileName))
+	if err != nil {
+		errLogger.Fatalf("无法打开列表文件: %v", err)
+	}
+	defer file.Close()
+
+	portMap := make(map[int]int)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		parts := strings.Fields(scanner.Text())
+		if len(parts) < 2 {
+			continue
+		}
+		for _, n := range strings.Split(strings.Trim(parts[1], "[]"), ",") {
+			n, port, ok := strings.Cut(n, ":")
+			if !ok {
+				continue
+			}
+			num, err1 := strconv.Atoi(n)
+			p, err2 := strconv.Atoi(port)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			portMap[num] = p
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		errLogger.Fatalf("文件读取错误: %v", err)
+	}
+	return portMap
+}
+
 // ValidGameList 验证 game_list.txt 文件的格式和内容是否有效。
 // 参数:
 //
@@ -171,6 +224,9 @@ func ValidGameList(currentDir, gameListFileName string) {
 	}
 	defer file.Close()
 
+	// 每个 IP 只能有一行：install/game.sh 的 get_index 只读取 IP 所在的第一行，LoadIpMap 也按 IP 保存
+	ipLines := make(map[string]int)
+	numLines := make(map[int]int)
 	scanner := bufio.NewScanner(file)
 	lineNum := 0
 	for scanner.Scan() {
@@ -187,6 +243,10 @@ func ValidGameList(currentDir, gameListFileName string) {
 		if net.ParseIP(parts[0]) == nil {
 			errLogger.Fatalf("第%d行包含无效IP: %s", lineNum, parts[0])
 		}
+		if first, ok := ipLines[parts[0]]; ok {
+			errLogger.Fatalf("第%d行的 IP %s 与第%d行重复，同一 IP 的 game 编号需写在同一行", lineNum, parts[0], first)
+		}
+		ipLines[parts[0]] = lineNum
 
 		if !strings.HasPrefix(parts[1], "[") || !strings.HasSuffix(parts[1], "]") {
 			errLogger.Fatalf("第%d行 game 编号格式错误", lineNum)
@@ -194,9 +254,18 @@ func ValidGameList(currentDir, gameListFileName string) {
 
 		nums := strings.Split(parts[1][1:len(parts[1])-1], ",")
 		for _, n := range nums {
-			if _, err = strconv.Atoi(n); err != nil {
+			n, port, hasPort := strings.Cut(n, ":")
+			num, err := strconv.Atoi(n)
+			if err != nil {
 				errLogger.Fatalf("第%d行game 编号为: 包含无效数字: %s", lineNum, n)
 			}
+			if first, ok := numLines[num]; ok {
+				errLogger.Fatalf("第%d行的 game 编号: %d 与第%d行重复", lineNum, num, first)
+			}
+			numLines[num] = lineNum
+			if p, err := strconv.Atoi(port); hasPort && (err != nil || p <= 0 || p > 65535) {
+				errLogger.Fatalf("第%d行 game 编号为: %s 的端口无效: %s", lineNum, n, port)
+			}
 		}
 
 		if _, err = strconv.Atoi(parts[2]); err != nil {
@@ -274,52 +343,133 @@ func ValidNextServer(num int, ipMap map[string][]string) bool {
 	return true
 }
 
-// InitDB 初始化并返回 MySQL 数据库连接。
+// DBOptions 日志数据库连接参数。
+type DBOptions struct {
+	Host            string        // 主库地址，支持 IP 或主机名
+	Port            int           // 主库端口
+	Replicas        []string      // 只读从库地址，host 或 host:port，按顺序优先于主库连接
+	User            string        // 用户名
+	Password        string        // 密码
+	Name            string        // 数据库名称
+	Params          string        // DSN 参数，例如 timeout=5s&readTimeout=30s
+	TLS             *tls.Config   // TLS 配置，为 nil 时不使用 TLS
+	MaxOpenConns    int           // 最大连接数
+	MaxIdleConns    int           // 最大空闲连接数
+	ConnMaxLifetime time.Duration // 连接最长存活时间
+}
+
+// addrs 返回按连接优先级排列的地址，从库在前，主库在后。
+func (o DBOptions) addrs() []string {
+	addrs := make([]string, 0, len(o.Replicas)+1)
+	for _, replica := range o.Replicas {
+		if _, _, err := net.SplitHostPort(replica); err != nil {
+			replica = net.JoinHostPort(replica, strconv.Itoa(o.Port))
+		}
+		addrs = append(addrs, replica)
+	}
+	return append(addrs, net.JoinHostPort(o.Host, strconv.Itoa(o.Port)))
+}
+
+// ParseDSNParams 解析 DSN 参数，返回应用了参数的驱动配置。
 // 参数:
 //
-//	logDBUser: 数据库用户名。
-//	logDBPassword: 数据库密码。
-//	logDBHost: 数据库主机地址。
-//	logDBPort: 数据库端口。
-//	logDBName: 数据库名称。
+//	params: URL 查询串形式的参数，例如 timeout=5s&readTimeout=30s，可为空。
 //
 // 返回值:
 //
-//	*sql.DB: 成功连接的数据库对象。
-//	error: 如果连接失败，返回错误信息；否则返回 nil。
-func InitDB(logDBUser, logDBPassword, logDBHost, logDBPort, logDBName string) (*sql.DB, error) {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s", logDBUser, logDBPassword, logDBHost, logDBPort, logDBName)
-	var db *sql.DB
-	var err error
-	maxRetries := 3
-	retryDelay := time.Second * 2
-
-	for i := 0; i < maxRetries; i++ {
-		db, err = sql.Open("mysql", dsn)
+//	*mysql.Config: 驱动配置。
+//	error: 如果参数无效，返回错误信息；否则返回 nil。
+func ParseDSNParams(params string) (*mysql.Config, error) {
+	if params == "" {
+		return mysql.NewConfig(), nil
+	}
+	cfg, err := mysql.ParseDSN("/?" + params)
+	if err != nil {
+		return nil, fmt.Errorf("数据库连接参数无效: %v", err)
+	}
+	return cfg, nil
+}
+
+// LoadTLSConfig 根据证书文件创建 TLS 配置。
+// 参数:
+//
+//	caFile: CA 证书文件，为空时使用系统 CA。
+//	certFile: 客户端证书文件，需与 keyFile 同时配置，可为空。
+//	keyFile: 客户端私钥文件。
+//	serverName: 校验证书使用的服务器名，为空时使用连接地址中的主机名。
+//
+// 返回值:
+//
+//	*tls.Config: TLS 配置。
+//	error: 如果证书文件读取或解析失败，返回错误信息；否则返回 nil。
+func LoadTLSConfig(caFile, certFile, keyFile, serverName string) (*tls.Config, error) {
+	cfg := &tls.Config{ServerName: serverName, MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
 		if err != nil {
-			warnLogger.Printf("尝试 %d: 创建数据库对象失败: %v", i+1, err)
-			time.Sleep(retryDelay)
-			retryDelay *= 2
-			continue
+			return nil, fmt.Errorf("读取 CA 证书失败: %v", err)
 		}
-		if err = db.Ping(); err == nil {
-			break
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA 证书 %s 中没有有效的 PEM 证书", caFile)
 		}
-		warnLogger.Printf("尝试 %d: 数据库连接失败: %v", i+1, err)
-		if db != nil {
-			db.Close()
+		cfg.RootCAs = pool
+	}
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("客户端证书和私钥需同时配置")
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("加载客户端证书失败: %v", err)
 		}
-		db = nil
-		time.Sleep(retryDelay)
-		retryDelay *= 2
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// Connect 连接 MySQL 数据库，配置了从库时优先连接从库，均不可用时连接主库，不重试，重连由调用方负责。
+// 参数:
+//
+//	opts: 连接参数。
+//
+// 返回值:
+//
+//	*sql.DB: 成功连接的数据库对象。
+//	string: 连接的地址。
+//	error: 如果所有地址均连接失败，返回最后一个地址的错误信息；否则返回 nil。
+func Connect(opts DBOptions) (*sql.DB, string, error) {
+	base, err := ParseDSNParams(opts.Params)
+	if err != nil {
+		return nil, "", err
 	}
-	if db == nil {
-		return nil, fmt.Errorf("数据库连接失败（共尝试 %d 次）: %v", maxRetries, err)
+	base.User = opts.User
+	base.Passwd = opts.Password
+	base.Net = "tcp"
+	base.DBName = opts.Name
+	if opts.TLS != nil {
+		base.TLS = opts.TLS
 	}
 
-	db.SetMaxOpenConns(5)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxLifetime(time.Hour)
-	successLogger.Println("数据库连接成功")
-	return db, nil
+	for _, addr := range opts.addrs() {
+		cfg := base.Clone()
+		cfg.Addr = addr
+		connector, connErr := mysql.NewConnector(cfg)
+		if connErr != nil {
+			err = fmt.Errorf("%s: %v", addr, connErr)
+			continue
+		}
+		db := sql.OpenDB(connector)
+		if pingErr := db.Ping(); pingErr != nil {
+			err = fmt.Errorf("%s: %v", addr, pingErr)
+			warnLogger.Printf("数据库连接失败 %v", err)
+			db.Close()
+			continue
+		}
+		db.SetMaxOpenConns(opts.MaxOpenConns)
+		db.SetMaxIdleConns(opts.MaxIdleConns)
+		db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+		return db, addr, nil
+	}
+	return nil, "", fmt.Errorf("数据库连接失败: %v", err)
 }
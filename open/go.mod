@@ -3,8 +3,8 @@ module open
 go 1.24.0
 
 require (
-	github.com/a8m/envsubst v1.4.3
 	github.com/go-sql-driver/mysql v1.8.1
+	github.com/yuin/gopher-lua v1.1.2
 )
 
 require filippo.io/edwards25519 v1.1.0 // indirect
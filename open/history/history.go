@@ -0,0 +1,169 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"open/loglevel"
+)
+
+var warnLogger = loglevel.GetWarnLogger()
+
+// Sample 一次采样的 game 指标。
+type Sample struct {
+	Time     time.Time `json:"time"`
+	Num      int       `json:"num"`
+	Register int       `json:"register"`         // 注册人数
+	Payers   int       `json:"payers"`           // 付费人数
+	Online   *int      `json:"online,omitempty"` // 在线人数，未配置来源或查询失败时为空
+}
+
+// Store 按 game 保存采样，每个 game 一个 JSONL 文件 game<编号>.jsonl，只追加不修改。
+type Store struct {
+	Dir string
+
+	mu sync.Mutex
+}
+
+// Open 打开采样目录，目录不存在时创建。
+// 参数:
+//
+//	dir: 采样目录。
+//
+// 返回值:
+//
+//	*Store: 采样存储。
+//	error: 如果目录创建失败，返回错误信息；否则返回 nil。
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建采样目录失败: %v", err)
+	}
+	return &Store{Dir: dir}, nil
+}
+
+// Path 返回 game 的采样文件路径。
+func (s *Store) Path(num int) string {
+	return filepath.Join(s.Dir, fmt.Sprintf("game%d.jsonl", num))
+}
+
+// Append 追加一条采样。
+// 参数:
+//
+//	sample: 采样。
+//
+// 返回值:
+//
+//	error: 如果写入失败，返回错误信息；否则返回 nil。
+func (s *Store) Append(sample Sample) error {
+	line, err := json.Marshal(sample)
+	if err != nil {
+		return fmt.Errorf("序列化采样失败: %v", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, err := os.OpenFile(s.Path(sample.Num), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("打开采样文件失败: %v", err)
+	}
+	if _, err = file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("写入采样失败: %v", err)
+	}
+	return file.Close()
+}
+
+// Load 读取 game 的所有采样，文件不存在时返回空，进程中断导致的不完整行会被跳过。
+// 参数:
+//
+//	num: game 编号。
+//
+// 返回值:
+//
+//	[]Sample: 按时间顺序排列的采样。
+//	error: 如果读取失败，返回错误信息；否则返回 nil。
+func (s *Store) Load(num int) ([]Sample, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, err := os.Open(s.Path(num))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("打开采样文件失败: %v", err)
+	}
+	defer file.Close()
+
+	var samples []Sample
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		var sample Sample
+		if err = json.Unmarshal(scanner.Bytes(), &sample); err != nil {
+			warnLogger.Printf("采样文件 %s 第%d行无效, 已跳过: %v", file.Name(), line, err)
+			continue
+		}
+		samples = append(samples, sample)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取采样文件失败: %v", err)
+	}
+	return samples, nil
+}
+
+// Since 返回 at 之前 window 时间内的采样，samples 需按时间排序。
+func Since(samples []Sample, at time.Time, window time.Duration) []Sample {
+	from := at.Add(-window)
+	for i, sample := range samples {
+		if !sample.Time.Before(from) {
+			end := i
+			for end < len(samples) && !samples[end].Time.After(at) {
+				end++
+			}
+			return samples[i:end]
+		}
+	}
+	return nil
+}
+
+// Span 返回最近 window 时间内第一个和最后一个采样的时间跨度，用于判断速率是否可信。
+func Span(samples []Sample, window time.Duration) time.Duration {
+	if len(samples) == 0 {
+		return 0
+	}
+	recent := Since(samples, samples[len(samples)-1].Time, window)
+	if len(recent) == 0 {
+		return 0
+	}
+	return recent[len(recent)-1].Time.Sub(recent[0].Time)
+}
+
+// Rate 计算最近 window 时间内的每分钟注册人数。
+// 参数:
+//
+//	samples: 按时间排序的采样。
+//	window: 统计窗口。
+//
+// 返回值:
+//
+//	float64: 每分钟注册人数。
+//	bool: 窗口内是否有至少两个时间不同的采样，否则无法计算。
+func Rate(samples []Sample, window time.Duration) (float64, bool) {
+	if len(samples) == 0 {
+		return 0, false
+	}
+	recent := Since(samples, samples[len(samples)-1].Time, window)
+	if len(recent) < 2 {
+		return 0, false
+	}
+	first, last := recent[0], recent[len(recent)-1]
+	minutes := last.Time.Sub(first.Time).Minutes()
+	if minutes <= 0 {
+		return 0, false
+	}
+	return float64(last.Register-first.Register) / minutes, true
+}
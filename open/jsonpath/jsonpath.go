@@ -0,0 +1,54 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// Lookup 按点分隔的路径取 JSON 中的值，数组使用数字下标，例如 data.list.0.code。
+// 参数:
+//
+//	data: json.Unmarshal 到 interface{} 的结果。
+//	path: 字段路径。
+//
+// 返回值:
+//
+//	interface{}: 路径处的值。
+//	bool: 路径是否存在，值为 null 的字段视为存在。
+func Lookup(data interface{}, path string) (interface{}, bool) {
+	for _, key := range strings.Split(path, ".") {
+		switch v := data.(type) {
+		case map[string]interface{}:
+			next, ok := v[key]
+			if !ok {
+				return nil, false
+			}
+			data = next
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			data = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return data, true
+}
+
+// Format 将 JSON 值转为字符串用于比较，数字不带多余的小数位。
+func Format(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return "null"
+	default:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+}
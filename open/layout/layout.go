@@ -0,0 +1,86 @@
+package layout
+
+import (
+	"encoding/json"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Layout 目标机目录结构和命名规则，路径和名称中的 {num} 替换为 game 编号。
+// Go 代码和所有 playbook（通过 extra-vars）都从这里取路径，方便其他游戏项目接入。
+type Layout struct {
+	GameDBName string // game 数据库名，例如 cbt4_game_{num}
+	GameDir    string // game 程序目录，例如 /data/server{num}/game
+	TmpDir     string // 安装时的临时解压目录，例如 /data/tmp_create_game{num}
+	UpdateDir  string // 安装包存放目录，例如 /data/update
+	DataDir    string // 开服前检查剩余空间的目录，例如 /data
+	LoginRoot  string // login 实例所在目录，其下 login* 目录为 login 实例，例如 /data/server
+	ListDir    string // login 节点上白名单和限制名单所在目录
+	WhiteList  string // 白名单文件名，例如 white_list.txt
+	LimitList  string // 限制名单文件名，例如 limit_create.txt
+}
+
+// Default 返回原有的目录结构。
+func Default() Layout {
+	return Layout{
+		GameDBName: "cbt4_game_{num}",
+		GameDir:    "/data/server{num}/game",
+		TmpDir:     "/data/tmp_create_game{num}",
+		UpdateDir:  "/data/update",
+		DataDir:    "/data",
+		LoginRoot:  "/data/server",
+		WhiteList:  "white_list.txt",
+		LimitList:  "limit_create.txt",
+	}
+}
+
+// DBName 返回指定 game 编号的数据库名。
+func (l Layout) DBName(num int) string {
+	return expand(l.GameDBName, num)
+}
+
+// GameDirOf 返回指定 game 编号在被控节点上的程序目录。
+func (l Layout) GameDirOf(num int) string {
+	return strings.TrimSuffix(expand(l.GameDir, num), "/")
+}
+
+// TmpDirOf 返回指定 game 编号安装时的临时解压目录。
+func (l Layout) TmpDirOf(num int) string {
+	return strings.TrimSuffix(expand(l.TmpDir, num), "/")
+}
+
+// WhitePath 返回 login 节点上白名单文件路径。
+func (l Layout) WhitePath() string {
+	return path.Join(l.ListDir, l.WhiteList)
+}
+
+// LimitPath 返回 login 节点上限制名单文件路径。
+func (l Layout) LimitPath() string {
+	return path.Join(l.ListDir, l.LimitList)
+}
+
+// ExtraVars 返回传给 playbook 的 extra-vars（json 格式），用于 ansible-playbook -e。
+// 参数:
+//
+//	num: game 编号，用于替换路径中的 {num}。
+//
+// 返回值:
+//
+//	string: json 格式的变量。
+func (l Layout) ExtraVars(num int) string {
+	vars := map[string]string{
+		"game_dir":   l.GameDirOf(num),
+		"tmp_dir":    l.TmpDirOf(num),
+		"update_dir": strings.TrimSuffix(l.UpdateDir, "/"),
+		"login_root": strings.TrimSuffix(l.LoginRoot, "/"),
+		"white_list": l.WhitePath(),
+		"limit_list": l.LimitPath(),
+	}
+	b, _ := json.Marshal(vars)
+	return string(b)
+}
+
+func expand(s string, num int) string {
+	return strings.ReplaceAll(s, "{num}", strconv.Itoa(num))
+}
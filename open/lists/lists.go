@@ -0,0 +1,299 @@
+package lists
+
+import (
+	"fmt"
+	"open/execute"
+	"open/layout"
+	"open/loglevel"
+	"open/runlog"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 名单类型
+const (
+	White = "white" // 白名单，其中的 game 对玩家不可见
+	Limit = "limit" // 限制名单，其中的 game 不允许创建角色
+)
+
+var (
+	infoLogger = loglevel.GetInfoLogger()
+	warnLogger = loglevel.GetWarnLogger()
+)
+
+// Path 返回登录服上名单文件的路径。
+func Path(lay layout.Layout, kind string) string {
+	if kind == Limit {
+		return lay.LimitPath()
+	}
+	return lay.WhitePath()
+}
+
+// Name 返回名单的中文名，用于日志。
+func Name(kind string) string {
+	if kind == Limit {
+		return "限制名单"
+	}
+	return "白名单"
+}
+
+// Read 读取多个登录服上的名单，文件不存在时视为空名单。
+// 参数:
+//
+//	run: 本次运行对象，ansible 输出写入其步骤日志文件。
+//	hosts: 登录服 IP 列表。
+//	lay: 目标机目录结构。
+//	kind: White 或 Limit。
+//
+// 返回值:
+//
+//	map[string][]int: 每个成功读取的登录服上的名单，已排序去重。
+//	map[string]error: 每个登录服的读取结果，nil 表示成功。
+func Read(run *runlog.Run, hosts []string, lay layout.Layout, kind string) (map[string][]int, map[string]error) {
+	path := Path(lay, kind)
+	outputs, errs := execute.AdhocOutput(run, "read-"+kind+"-list", hosts, "shell",
+		fmt.Sprintf("if [ -f %s ]; then cat %s; fi", path, path))
+
+	contents := make(map[string][]int, len(outputs))
+	for host, output := range outputs {
+		values, err := Parse(output)
+		if err != nil {
+			errs[host] = fmt.Errorf("%s %s: %v", host, path, err)
+			continue
+		}
+		contents[host] = values
+	}
+	return contents, errs
+}
+
+// Parse 解析名单文件内容，每行一个 game 编号，忽略空行，返回排序去重后的结果。
+// 参数:
+//
+//	content: 文件内容。
+//
+// 返回值:
+//
+//	[]int: 排序去重后的 game 编号。
+//	error: 如果存在非数字行，返回错误信息，避免覆盖写入时丢失内容；否则返回 nil。
+func Parse(content string) ([]int, error) {
+	set := make(map[int]bool)
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		num, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, fmt.Errorf("第%d行不是 game 编号: %q", i+1, line)
+		}
+		set[num] = true
+	}
+	return sorted(set), nil
+}
+
+// Desired 根据资产清单和最新已开 game 编号计算名单的期望内容，清单之外的编号保持不变。
+// 白名单：移除已开的 game（编号小于等于 openNum），保留未开的 game。
+// 限制名单：加入旧 game（编号小于 openNum），移除最新 game 和未开的 game。
+// 参数:
+//
+//	kind: White 或 Limit。
+//	current: 登录服上的当前内容。
+//	inventory: game_list.txt 中的所有 game 编号。
+//	openNum: 最新已开的 game 编号。
+//
+// 返回值:
+//
+//	[]int: 排序后的期望内容。
+func Desired(kind string, current, inventory []int, openNum int) []int {
+	set := make(map[int]bool, len(current)+len(inventory))
+	for _, num := range current {
+		set[num] = true
+	}
+	for _, num := range inventory {
+		if kind == White {
+			set[num] = num > openNum
+		} else {
+			set[num] = num < openNum
+		}
+	}
+	if kind == White {
+		delete(set, openNum)
+	}
+	return sorted(set)
+}
+
+// Diff 比较名单的当前内容和期望内容。
+// 参数:
+//
+//	current: 当前内容。
+//	desired: 期望内容。
+//
+// 返回值:
+//
+//	added: 需要加入的编号。
+//	removed: 需要移除的编号。
+func Diff(current, desired []int) (added, removed []int) {
+	have := make(map[int]bool, len(current))
+	for _, num := range current {
+		have[num] = true
+	}
+	want := make(map[int]bool, len(desired))
+	for _, num := range desired {
+		want[num] = true
+		if !have[num] {
+			added = append(added, num)
+		}
+	}
+	for _, num := range current {
+		if !want[num] {
+			removed = append(removed, num)
+		}
+	}
+	return added, removed
+}
+
+// FormatDiff 返回 +[1 2] -[3] 形式的差异描述。
+func FormatDiff(added, removed []int) string {
+	return fmt.Sprintf("+%v -%v", added, removed)
+}
+
+// Apply 覆盖写入单个登录服上的名单，先写临时文件再 rename，登录服读取时不会看到写了一半的文件。
+// 参数:
+//
+//	run: 本次运行对象，ansible 输出写入其步骤日志文件。
+//	host: 登录服 IP。
+//	lay: 目标机目录结构。
+//	kind: White 或 Limit。
+//	values: 名单内容。
+//
+// 返回值:
+//
+//	error: 如果写入失败，返回错误信息；否则返回 nil。
+func Apply(run *runlog.Run, host string, lay layout.Layout, kind string, values []int) error {
+	path := Path(lay, kind)
+	tmp := path + ".open.tmp"
+	write := fmt.Sprintf(": > %s", tmp)
+	if len(values) > 0 {
+		nums := make([]string, len(values))
+		for i, num := range values {
+			nums[i] = strconv.Itoa(num)
+		}
+		write = fmt.Sprintf("printf '%%s\\n' %s > %s", strings.Join(nums, " "), tmp)
+	}
+	err := execute.Adhoc(run, fmt.Sprintf("write-%s-list-%s", kind, host), []string{host}, "shell",
+		fmt.Sprintf("%s && mv -f %s %s", write, tmp, path))[host]
+	if err != nil {
+		return fmt.Errorf("写入%s失败: %v", Name(kind), err)
+	}
+	return nil
+}
+
+// Sync 读取单个登录服上的名单，与期望内容比对，有差异时输出差异并写入。
+// 参数:
+//
+//	run: 本次运行对象，ansible 输出写入其步骤日志文件。
+//	host: 登录服 IP。
+//	lay: 目标机目录结构。
+//	kind: White 或 Limit。
+//	inventory: game_list.txt 中的所有 game 编号。
+//	openNum: 最新已开的 game 编号。
+//
+// 返回值:
+//
+//	bool: 是否写入了变更。
+//	error: 如果读取或写入失败，返回错误信息；否则返回 nil。
+func Sync(run *runlog.Run, host string, lay layout.Layout, kind string, inventory []int, openNum int) (bool, error) {
+	contents, errs := Read(run, []string{host}, lay, kind)
+	if err := errs[host]; err != nil {
+		return false, fmt.Errorf("读取%s失败: %v", Name(kind), err)
+	}
+	current := contents[host]
+	desired := Desired(kind, current, inventory, openNum)
+	added, removed := Diff(current, desired)
+	if len(added) == 0 && len(removed) == 0 {
+		infoLogger.Printf("登录服 %s %s无需变更", host, Name(kind))
+		return false, nil
+	}
+	infoLogger.Printf("登录服 %s %s变更: %s", host, Name(kind), FormatDiff(added, removed))
+	if err := Apply(run, host, lay, kind, desired); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Drift 比较各登录服上的名单，返回与多数登录服不一致的登录服及差异，全部一致时返回空。
+// 参数:
+//
+//	contents: 每个登录服上的名单，来自 Read。
+//
+// 返回值:
+//
+//	map[string]string: 不一致的登录服到差异描述的映射，差异相对于多数登录服的内容。
+func Drift(contents map[string][]int) map[string]string {
+	counts := make(map[string]int)
+	var majority string
+	for _, values := range contents {
+		key := fmt.Sprint(values)
+		counts[key]++
+		if counts[key] > counts[majority] || (counts[key] == counts[majority] && key < majority) {
+			majority = key
+		}
+	}
+	var reference []int
+	for _, values := range contents {
+		if fmt.Sprint(values) == majority {
+			reference = values
+			break
+		}
+	}
+
+	drift := make(map[string]string)
+	for host, values := range contents {
+		if fmt.Sprint(values) == majority {
+			continue
+		}
+		added, removed := Diff(reference, values)
+		drift[host] = FormatDiff(added, removed)
+	}
+	return drift
+}
+
+// ReportDrift 读取所有登录服上的两个名单并输出不一致的登录服，只报告不修改。
+// 参数:
+//
+//	run: 本次运行对象，ansible 输出写入其步骤日志文件。
+//	hosts: 登录服 IP 列表。
+//	lay: 目标机目录结构。
+//
+// 返回值:
+//
+//	bool: 所有登录服的名单是否一致且均读取成功。
+func ReportDrift(run *runlog.Run, hosts []string, lay layout.Layout) bool {
+	ok := true
+	for _, kind := range []string{White, Limit} {
+		contents, errs := Read(run, hosts, lay, kind)
+		for _, host := range hosts {
+			if errs[host] != nil {
+				warnLogger.Printf("登录服 %s 读取%s失败: %v", host, Name(kind), errs[host])
+				ok = false
+			}
+		}
+		for host, diff := range Drift(contents) {
+			warnLogger.Printf("登录服 %s %s与其他登录服不一致: %s", host, Name(kind), diff)
+			ok = false
+		}
+	}
+	return ok
+}
+
+func sorted(set map[int]bool) []int {
+	values := make([]int, 0, len(set))
+	for num, ok := range set {
+		if ok {
+			values = append(values, num)
+		}
+	}
+	sort.Ints(values)
+	return values
+}
@@ -0,0 +1,166 @@
+package logdb
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"open/getsomething"
+	"open/loglevel"
+	"open/notify"
+	"open/redact"
+)
+
+const (
+	minBackoff = 5 * time.Second
+	// DefaultMaxBackoff 重连间隔上限的默认值。
+	DefaultMaxBackoff = 5 * time.Minute
+	// DefaultOutageNotify 日志库不可用多久后发送通知的默认值。
+	DefaultOutageNotify = 5 * time.Minute
+)
+
+// Status 日志库连接状态，用于判断指标是否可用。
+type Status struct {
+	Available bool      `json:"available"`
+	Addr      string    `json:"addr,omitempty"`       // 当前连接的地址
+	DownSince time.Time `json:"down_since,omitempty"` // 不可用的开始时间
+	LastError string    `json:"last_error,omitempty"`
+	NextRetry time.Time `json:"next_retry,omitempty"`
+}
+
+// Client 受监管的日志库连接，连接失效时按指数退避重连，不可用期间 DB 返回错误，调用方据此暂停开服判断。
+// 不可用持续超过 OutageNotify 时发送一次通知，恢复后再发送一次。
+type Client struct {
+	Options      getsomething.DBOptions
+	MaxBackoff   time.Duration
+	OutageNotify time.Duration
+	Notifier     notify.Notifier
+	// Label 通知中的名称，多项目时为项目名。
+	Label string
+	loglevel.Loggers
+
+	mu       sync.Mutex // 保护连接和重连，重连期间持有
+	db       *sql.DB
+	statusMu sync.Mutex // 保护 status，重连期间也能读取状态
+	status   Status
+	backoff  time.Duration
+	notified bool
+}
+
+// DB 返回可用的数据库连接，连接失效时在到达重连时间后尝试重连一次，不会阻塞等待。
+// 返回值:
+//
+//	*sql.DB: 数据库连接对象。
+//	error: 如果日志库不可用，返回包含最近一次错误和下次重连时间的错误信息；否则返回 nil。
+func (c *Client) DB() (*sql.DB, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.db != nil {
+		err := c.db.Ping()
+		if err == nil {
+			return c.db, nil
+		}
+		c.Warn.Printf("日志库连接失效: %v", err)
+		c.db.Close()
+		c.db = nil
+		c.markDown(err)
+	}
+
+	now := time.Now()
+	if now.Before(c.status.NextRetry) {
+		c.checkOutage(now)
+		return nil, c.unavailable()
+	}
+	db, addr, err := getsomething.Connect(c.Options)
+	if err != nil {
+		c.markDown(err)
+		c.scheduleRetry(now)
+		c.checkOutage(now)
+		return nil, c.unavailable()
+	}
+
+	if !c.status.DownSince.IsZero() {
+		c.Success.Printf("日志库已恢复, 不可用持续 %s", now.Sub(c.status.DownSince).Round(time.Second))
+		if c.notified {
+			notify.Send(c.Notifier, fmt.Sprintf("[%s] 日志库已恢复, 不可用持续 %s", c.Label, now.Sub(c.status.DownSince).Round(time.Second)))
+		}
+	} else {
+		c.Success.Printf("日志库连接成功: %s", addr)
+	}
+	c.db = db
+	c.setStatus(func(s *Status) { *s = Status{Available: true, Addr: addr} })
+	c.backoff = 0
+	c.notified = false
+	return db, nil
+}
+
+// Status 返回当前连接状态。
+func (c *Client) Status() Status {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+	return c.status
+}
+
+func (c *Client) setStatus(fn func(s *Status)) {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+	fn(&c.status)
+}
+
+// Close 关闭数据库连接。
+func (c *Client) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.db != nil {
+		c.db.Close()
+		c.db = nil
+	}
+}
+
+func (c *Client) markDown(err error) {
+	c.setStatus(func(s *Status) {
+		if s.DownSince.IsZero() {
+			s.DownSince = time.Now()
+		}
+		s.Available = false
+		s.Addr = ""
+		s.LastError = redact.String(err.Error()) // 状态接口和通知中不出现密码
+	})
+}
+
+// scheduleRetry 计算下次重连时间，间隔从 5 秒开始翻倍，不超过 MaxBackoff
+func (c *Client) scheduleRetry(now time.Time) {
+	maxBackoff := c.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultMaxBackoff
+	}
+	if c.backoff == 0 {
+		c.backoff = minBackoff
+	} else if c.backoff *= 2; c.backoff > maxBackoff {
+		c.backoff = maxBackoff
+	}
+	c.setStatus(func(s *Status) { s.NextRetry = now.Add(c.backoff) })
+	c.Warn.Printf("日志库重连失败, %s 后重试: %s", c.backoff, c.status.LastError)
+}
+
+// checkOutage 不可用持续超过 OutageNotify 时发送一次通知
+func (c *Client) checkOutage(now time.Time) {
+	threshold := c.OutageNotify
+	if threshold <= 0 {
+		threshold = DefaultOutageNotify
+	}
+	down := now.Sub(c.status.DownSince)
+	if c.notified || down < threshold {
+		return
+	}
+	c.Err.Printf("日志库不可用已持续 %s, 暂停开服判断: %s", down.Round(time.Second), c.status.LastError)
+	notify.Send(c.Notifier, fmt.Sprintf("[%s] 日志库不可用已持续 %s, 暂停开服判断: %s", c.Label, down.Round(time.Second), c.status.LastError))
+	c.notified = true
+}
+
+func (c *Client) unavailable() error {
+	return fmt.Errorf("日志库不可用, 自 %s 起, 下次重连 %s: %s",
+		c.status.DownSince.Format("2006-01-02 15:04:05"), c.status.NextRetry.Format("15:04:05"), c.status.LastError)
+}
@@ -0,0 +1,120 @@
+package loginreload
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"open/execute"
+	"open/layout"
+	"open/loglevel"
+	"open/runlog"
+	"strings"
+	"time"
+)
+
+// 重载方式
+const (
+	MethodPlaybook = "playbook" // 执行 login.yaml，在每个 login 实例目录下 ./server.sh reload
+	MethodAdmin    = "admin"    // 调用 login 服务的管理接口
+)
+
+const defaultTimeout = 10 * time.Second
+
+var infoLogger = loglevel.GetInfoLogger()
+
+// Reloader 重载单个登录服上的 login 服务，使白名单和限制名单生效。
+type Reloader interface {
+	Reload(run *runlog.Run, host string) error
+}
+
+// ValidMethod 判断重载方式是否有效。
+func ValidMethod(method string) bool {
+	return method == MethodPlaybook || method == MethodAdmin
+}
+
+// Playbook 通过 login.yaml 重载登录服。
+type Playbook struct {
+	Layout   layout.Layout
+	BookPath string
+}
+
+// Reload 执行 login.yaml 重载登录服上的所有 login 实例。
+func (p *Playbook) Reload(run *runlog.Run, host string) error {
+	return execute.ReloadLogin(run, p.Layout, 0, host, p.BookPath)
+}
+
+// Admin 通过 login 服务的管理接口重载登录服，每个登录服上可以有多个 login 实例。
+type Admin struct {
+	// Endpoints 管理接口地址，{ip} 替换为登录服 IP。
+	// http://、https:// 发送 POST 请求，要求返回 2xx；tcp:// 发送 Command 并读取一行应答。
+	Endpoints []string
+	// Command tcp 接口发送的命令，自动追加换行。
+	Command string
+	// Ack 应答中必须包含的内容，为空时 http 只检查状态码，tcp 只要求有应答。
+	Ack string
+	// Timeout 单个接口的超时时间，为 0 时使用 10 秒。
+	Timeout time.Duration
+}
+
+// Reload 依次调用登录服上的每个管理接口并等待确认。
+func (a *Admin) Reload(run *runlog.Run, host string) error {
+	for _, endpoint := range a.Endpoints {
+		target := strings.ReplaceAll(endpoint, "{ip}", host)
+		infoLogger.Printf("正在通过管理接口 reload login: %s", target)
+		if err := a.call(target); err != nil {
+			return fmt.Errorf("管理接口 %s reload 失败: %v", target, err)
+		}
+	}
+	return nil
+}
+
+func (a *Admin) call(target string) error {
+	timeout := a.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return fmt.Errorf("地址格式错误: %v", err)
+	}
+
+	var reply string
+	switch u.Scheme {
+	case "http", "https":
+		client := &http.Client{Timeout: timeout}
+		resp, err := client.Post(target, "text/plain", strings.NewReader(a.Command))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		reply = string(body)
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("状态码 %d: %s", resp.StatusCode, strings.TrimSpace(reply))
+		}
+	case "tcp":
+		conn, err := net.DialTimeout("tcp", u.Host, timeout)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(timeout))
+		if _, err = fmt.Fprintf(conn, "%s\n", a.Command); err != nil {
+			return fmt.Errorf("发送命令失败: %v", err)
+		}
+		reply, err = bufio.NewReader(conn).ReadString('\n')
+		if err != nil && reply == "" {
+			return fmt.Errorf("未收到应答: %v", err)
+		}
+	default:
+		return fmt.Errorf("不支持的协议 %s", u.Scheme)
+	}
+
+	if a.Ack != "" && !strings.Contains(reply, a.Ack) {
+		return fmt.Errorf("应答中不包含 %q: %s", a.Ack, strings.TrimSpace(reply))
+	}
+	return nil
+}
@@ -2,10 +2,15 @@ package loglevel
 
 import (
 	"log"
+	"open/redact"
 	"os"
 )
 
 var (
+	// 所有日志经过密钥屏蔽后输出
+	stdout = redact.NewWriter(os.Stdout)
+	stderr = redact.NewWriter(os.Stderr)
+
 	infoLogger    *log.Logger
 	successLogger *log.Logger
 	warnLogger    *log.Logger
@@ -13,10 +18,10 @@ var (
 )
 
 func Init() {
-	infoLogger = log.New(os.Stdout, "[INFO] ", log.Ldate|log.Ltime|log.Lshortfile)
-	successLogger = log.New(os.Stdout, "[SUCCESS] ", log.Ldate|log.Ltime|log.Lshortfile)
-	warnLogger = log.New(os.Stderr, "[WARNING] ", log.Ldate|log.Ltime|log.Lshortfile)
-	errLogger = log.New(os.Stderr, "[ERROR] ", log.Ldate|log.Ltime|log.Lshortfile)
+	infoLogger = log.New(stdout, "[INFO] ", log.Ldate|log.Ltime|log.Lshortfile)
+	successLogger = log.New(stdout, "[SUCCESS] ", log.Ldate|log.Ltime|log.Lshortfile)
+	warnLogger = log.New(stderr, "[WARNING] ", log.Ldate|log.Ltime|log.Lshortfile)
+	errLogger = log.New(stderr, "[ERROR] ", log.Ldate|log.Ltime|log.Lshortfile)
 }
 
 func GetInfoLogger() *log.Logger {
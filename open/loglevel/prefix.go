@@ -0,0 +1,33 @@
+package loglevel
+
+import (
+	"log"
+)
+
+// Loggers 一组日志对象，多项目运行时用于在每行日志中区分项目。
+type Loggers struct {
+	Info    *log.Logger
+	Success *log.Logger
+	Warn    *log.Logger
+	Err     *log.Logger
+}
+
+// WithPrefix 返回在级别后附加 [name] 的日志对象，name 为空时返回全局日志对象。
+func WithPrefix(name string) Loggers {
+	if name == "" {
+		return Loggers{
+			Info:    GetInfoLogger(),
+			Success: GetSuccessLogger(),
+			Warn:    GetWarnLogger(),
+			Err:     GetErrLogger(),
+		}
+	}
+	tag := "[" + name + "] "
+	flags := log.Ldate | log.Ltime | log.Lshortfile
+	return Loggers{
+		Info:    log.New(stdout, "[INFO] "+tag, flags),
+		Success: log.New(stdout, "[SUCCESS] "+tag, flags),
+		Warn:    log.New(stderr, "[WARNING] "+tag, flags),
+		Err:     log.New(stderr, "[ERROR] "+tag, flags),
+	}
+}
@@ -0,0 +1,69 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"open/loglevel"
+	"open/redact"
+	"strings"
+	"time"
+)
+
+// DefaultTemplate 默认请求体，{message} 替换为经过 JSON 转义的消息内容。
+const DefaultTemplate = `{"text":"{message}"}`
+
+const defaultTimeout = 10 * time.Second
+
+var warnLogger = loglevel.GetWarnLogger()
+
+// Notifier 发送告警通知。
+type Notifier interface {
+	Notify(message string) error
+}
+
+// Webhook 通过 HTTP POST 发送通知，可对接钉钉、企业微信、飞书等机器人。
+type Webhook struct {
+	URL string
+	// Template 请求体模板，{message} 替换为消息内容，为空时使用 DefaultTemplate。
+	Template string
+	// Timeout 请求超时时间，为 0 时使用 10 秒。
+	Timeout time.Duration
+}
+
+// Notify 发送通知，要求返回 2xx。
+func (w *Webhook) Notify(message string) error {
+	template := w.Template
+	if template == "" {
+		template = DefaultTemplate
+	}
+	escaped, _ := json.Marshal(message)
+	body := strings.ReplaceAll(template, "{message}", string(escaped[1:len(escaped)-1]))
+
+	timeout := w.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Post(w.URL, "application/json", strings.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("发送通知失败: %v", err)
+	}
+	defer resp.Body.Close()
+	reply, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("发送通知失败, 状态码 %d: %s", resp.StatusCode, strings.TrimSpace(string(reply)))
+	}
+	return nil
+}
+
+// Send 屏蔽密钥后发送通知，notifier 为 nil 时不发送，发送失败只记录日志。
+func Send(notifier Notifier, message string) {
+	if notifier == nil {
+		return
+	}
+	if err := notifier.Notify(redact.String(message)); err != nil {
+		warnLogger.Printf("%v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package online
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"open/execute"
+	"open/jsonpath"
+	"open/logdb"
+)
+
+// 在线人数来源
+const (
+	SourceSQL  = "sql"  // 在日志库中执行 SQL 查询
+	SourceHTTP = "http" // 请求 game 或 gm 服务的 HTTP 接口
+)
+
+const defaultTimeout = 10 * time.Second
+
+// Source 查询 game 的当前在线人数。
+type Source interface {
+	Count(num int) (int, error)
+}
+
+// ValidSource 判断在线人数来源是否有效。
+func ValidSource(source string) bool {
+	return source == SourceSQL || source == SourceHTTP
+}
+
+// SQL 在日志库中执行 SQL 查询在线人数，Query 返回单行单列，其中的 ? 均替换为 game 编号。
+type SQL struct {
+	DB    *logdb.Client
+	Query string
+}
+
+// Count 执行查询并返回在线人数。
+func (s *SQL) Count(num int) (int, error) {
+	db, err := s.DB.DB()
+	if err != nil {
+		return 0, err
+	}
+	args := make([]interface{}, strings.Count(s.Query, "?"))
+	for i := range args {
+		args[i] = num
+	}
+	return execute.QueryCount(db, s.Query, args...)
+}
+
+// HTTP 通过 GET 请求查询在线人数，URL 中的 {num} 替换为 game 编号。
+type HTTP struct {
+	URL string
+	// Field 响应 JSON 中在线人数的字段，路径规则与 cdn.json 的 success_path 相同，例如 data.online；为空时响应体本身为数字。
+	Field string
+	// Timeout 请求超时时间，为 0 时使用 10 秒。
+	Timeout time.Duration
+}
+
+// Count 请求接口并返回在线人数，要求返回 2xx。
+func (h *HTTP) Count(num int) (int, error) {
+	timeout := h.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	target := strings.ReplaceAll(h.URL, "{num}", strconv.Itoa(num))
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(target)
+	if err != nil {
+		return 0, fmt.Errorf("查询在线人数失败: %v", err)
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return 0, fmt.Errorf("读取在线人数响应失败: %v", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return 0, fmt.Errorf("查询在线人数失败, 状态码 %d", resp.StatusCode)
+	}
+
+	var data interface{}
+	if err = json.Unmarshal(content, &data); err != nil {
+		return 0, fmt.Errorf("解析在线人数响应失败: %v", err)
+	}
+	// 与 cdn.json 中 success_path 使用相同的路径规则
+	if h.Field != "" {
+		value, ok := jsonpath.Lookup(data, h.Field)
+		if !ok {
+			return 0, fmt.Errorf("在线人数响应中不存在字段 %s", h.Field)
+		}
+		data = value
+	}
+	count, err := strconv.Atoi(jsonpath.Format(data))
+	if err != nil {
+		return 0, fmt.Errorf("在线人数字段 %s 不是整数: %s", h.Field, jsonpath.Format(data))
+	}
+	return count, nil
+}
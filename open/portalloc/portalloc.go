@@ -0,0 +1,88 @@
+package portalloc
+
+import (
+	"fmt"
+	"open/getsomething"
+	"strconv"
+)
+
+// 端口分配策略
+const (
+	StrategyNum      = "num"      // base + game 编号，原 open 的算法，例如 12000+N
+	StrategyIndex    = "index"    // base + 在 game_list.txt 所在行中从 0 开始的位置 * step，例如 3340+index*1000
+	StrategyExplicit = "explicit" // 使用 game_list.txt 中显式配置的端口，格式 [1:3340,4:4340]
+)
+
+// Allocator 根据策略计算 game 端口，并检测同一 IP 上的端口冲突。
+type Allocator struct {
+	Strategy string
+	Base     int
+	Step     int
+	IPMap    map[string][]string // IP 地址到 game 编号列表的映射表
+	Explicit map[int]int         // game_list.txt 中显式配置的端口
+	Recorded map[int]int         // 状态文件中已记录的端口，已部署的 game 以此为准
+}
+
+// ValidStrategy 判断策略名是否有效。
+func ValidStrategy(strategy string) bool {
+	return strategy == StrategyNum || strategy == StrategyIndex || strategy == StrategyExplicit
+}
+
+// Port 返回指定 game 编号的端口，并检查与同一 IP 上其他 game 是否冲突。
+// 参数:
+//
+//	num: game 编号。
+//
+// 返回值:
+//
+//	int: 分配的端口。
+//	error: 如果编号不存在、缺少显式端口或端口冲突，返回错误信息；否则返回 nil。
+func (a *Allocator) Port(num int) (int, error) {
+	ip, err := getsomething.GetGameIP(num, a.IPMap)
+	if err != nil {
+		return 0, err
+	}
+	port, err := a.port(num, ip)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, s := range a.IPMap[ip] {
+		other, _ := strconv.Atoi(s)
+		if other == num {
+			continue
+		}
+		otherPort, err := a.port(other, ip)
+		if err != nil {
+			continue
+		}
+		if otherPort == port {
+			return 0, fmt.Errorf("game 编号: %d 与 game 编号: %d 在 %s 上端口 %d 冲突", num, other, ip, port)
+		}
+	}
+	return port, nil
+}
+
+func (a *Allocator) port(num int, ip string) (int, error) {
+	if port, ok := a.Recorded[num]; ok {
+		return port, nil
+	}
+	switch a.Strategy {
+	case StrategyIndex:
+		// 与 install/game.sh 的 get_index 一致：取 IP 所在行（ValidGameList 保证每个 IP 只有一行）中编号的下标
+		for i, s := range a.IPMap[ip] {
+			if s == strconv.Itoa(num) {
+				return a.Base + i*a.Step, nil
+			}
+		}
+		return 0, fmt.Errorf("未找到 game 编号为: %d 在 %s 中的位置", num, ip)
+	case StrategyExplicit:
+		port, ok := a.Explicit[num]
+		if !ok {
+			return 0, fmt.Errorf("game_list.txt 中未配置 game 编号为: %d 的端口", num)
+		}
+		return port, nil
+	default:
+		return a.Base + num, nil
+	}
+}
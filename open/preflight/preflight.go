@@ -0,0 +1,101 @@
+package preflight
+
+import (
+	"fmt"
+	"open/check"
+	"open/execute"
+	"open/gamedb"
+	"open/loglevel"
+	"open/runlog"
+)
+
+var (
+	infoLogger    = loglevel.GetInfoLogger()
+	successLogger = loglevel.GetSuccessLogger()
+	errLogger     = loglevel.GetErrLogger()
+)
+
+// Options 开服前检查所需的参数。
+type Options struct {
+	GameNum    int      // 待开服的 game 编号
+	GameIP     string   // 待开服 game 所在 IP
+	LoginIPs   []string // 所有 login 节点 IP
+	GameDir    string   // game 程序目录，例如 /data/server5/game
+	Install    bool     // 是否会在本次开服中安装 game，为 true 时不要求目录存在，但要求端口空闲
+	GamePort   int      // game 服务端口
+	DataDir    string   // 检查剩余空间的目录
+	MinFreeMB  int      // 最小剩余空间，单位 MB，0 表示不检查
+	DBHost     string   // game 数据库地址
+	DBUser     string   // game 数据库用户
+	DBPassword string   // game 数据库密码
+	DBName     string   // game 数据库名，为空时只检查数据库服务（数据库由开服流程创建）
+}
+
+// Run 在做任何变更之前检查待开服 game 及 login 节点的状态。
+// 参数:
+//
+//	run: 本次运行对象，ansible 输出写入其步骤日志文件。
+//	opts: 检查参数。
+//
+// 返回值:
+//
+//	*check.Report: 所有检查项的结果，调用方通过 Failed 判断是否中止开服。
+func Run(run *runlog.Run, opts Options) *check.Report {
+	report := new(check.Report)
+	infoLogger.Printf("正在执行开服前检查, game 编号为:%d IP:%s", opts.GameNum, opts.GameIP)
+
+	// SSH 连通性
+	hosts := uniqueHosts(append([]string{opts.GameIP}, opts.LoginIPs...))
+	pingResults := execute.Adhoc(run, "preflight-ping", hosts, "ping", "")
+	for _, host := range hosts {
+		report.Add("SSH 连通", host, pingResults[host])
+	}
+
+	if pingResults[opts.GameIP] != nil {
+		report.Add("主机检查", opts.GameIP, fmt.Errorf("SSH 不可达，跳过目录、磁盘和端口检查"))
+	} else {
+		if !opts.Install {
+			err := execute.Adhoc(run, "preflight-game-dir", []string{opts.GameIP}, "shell",
+				fmt.Sprintf("test -d %s || { echo '目录 %s 不存在'; exit 1; }", opts.GameDir, opts.GameDir))[opts.GameIP]
+			report.Add("game 目录", fmt.Sprintf("%s:%s", opts.GameIP, opts.GameDir), err)
+		}
+
+		if opts.MinFreeMB > 0 {
+			err := execute.Adhoc(run, "preflight-disk", []string{opts.GameIP}, "shell",
+				fmt.Sprintf("avail=$(df -Pm %s | awk 'NR==2{print $4}'); "+
+					"[ \"$avail\" -ge %d ] || { echo \"%s 剩余 ${avail}MB, 低于 %dMB\"; exit 1; }",
+					opts.DataDir, opts.MinFreeMB, opts.DataDir, opts.MinFreeMB))[opts.GameIP]
+			report.Add("磁盘空间", fmt.Sprintf("%s:%s", opts.GameIP, opts.DataDir), err)
+		}
+
+		if opts.Install {
+			err := execute.Adhoc(run, "preflight-port", []string{opts.GameIP}, "shell",
+				fmt.Sprintf("if (ss -ltn 2>/dev/null || netstat -ltn) | awk '{print $4}' | grep -Eq '[:.]%d$'; "+
+					"then echo '端口 %d 已被占用'; exit 1; fi", opts.GamePort, opts.GamePort))[opts.GameIP]
+			report.Add("端口空闲", fmt.Sprintf("%s:%d", opts.GameIP, opts.GamePort), err)
+		}
+	}
+
+	report.Add("game 数据库", fmt.Sprintf("%s/%s", opts.DBHost, opts.DBName),
+		gamedb.Ping(opts.DBUser, opts.DBPassword, opts.DBHost, opts.DBName))
+
+	if report.Failed() {
+		errLogger.Printf("开服前检查未通过, game 编号为:%d\n%s", opts.GameNum, report)
+	} else {
+		successLogger.Printf("开服前检查通过, game 编号为:%d\n%s", opts.GameNum, report)
+	}
+	return report
+}
+
+func uniqueHosts(hosts []string) []string {
+	seen := make(map[string]bool, len(hosts))
+	out := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		if h == "" || seen[h] {
+			continue
+		}
+		seen[h] = true
+		out = append(out, h)
+	}
+	return out
+}
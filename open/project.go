@@ -0,0 +1,888 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"open/artifact"
+	"open/cdn"
+	"open/execute"
+	"open/gamedb"
+	"open/getsomething"
+	"open/history"
+	"open/lists"
+	"open/logdb"
+	"open/loginreload"
+	"open/loglevel"
+	"open/notify"
+	"open/online"
+	"open/portalloc"
+	"open/preflight"
+	"open/redact"
+	"open/runlog"
+	"open/state"
+	"open/verify"
+)
+
+const (
+	resyncInterval    = 5 * time.Minute
+	panicRestartDelay = time.Minute
+	opReload          = "reload" // 待补齐的登录服重载，其余待补齐操作为名单类型
+)
+
+// opName 返回待补齐操作的中文名
+func opName(op string) string {
+	if op == opReload {
+		return "重载"
+	}
+	return lists.Name(op)
+}
+
+// project 一个游戏项目，拥有独立的配置、清单文件、日志库连接和状态，各项目的监控循环互不影响
+type project struct {
+	name string
+	dir  string
+	*config
+
+	ipMap        map[string][]string
+	ipGroup      map[string]int
+	portMap      map[int]int
+	loginSlice   []string
+	db           *logdb.Client
+	currentNum   int
+	runLogPath   string
+	daemonState  *state.State
+	prewarmRetry time.Time
+	resyncAfter  time.Time
+
+	online   online.Source // 未配置在线人数来源时为 nil
+	history  *history.Store
+	samples  []history.Sample // 当前 game 最近的采样，用于计算注册速率
+	statusMu sync.Mutex
+	status   projectStatus // 最近一次采样的状态，供状态接口读取
+
+	cdnProviders []cdn.Provider
+	reloader     loginreload.Reloader
+
+	loglevel.Loggers
+}
+
+// newProject 从项目目录加载清单文件、状态文件并连接日志库
+// 参数:
+//
+//	name: 项目名，单项目时为空。
+//	dir: 项目目录，包含 game_list.txt、login_list.txt、init.txt 和 state.json。
+//	cfg: 项目配置。
+//
+// 返回值:
+//
+//	*project: 加载完成的项目。
+//	error: 如果状态文件或日志库初始化失败，返回错误信息；否则返回 nil。
+func newProject(name, dir string, cfg *config) (*project, error) {
+	p := &project{name: name, dir: dir, config: cfg, Loggers: loglevel.WithPrefix(name)}
+
+	var err error
+	p.cdnProviders, err = cdn.Load(filepath.Join(dir, cdnConfigFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		if cfg.cdnURL == "" {
+			return nil, fmt.Errorf("未配置 cdnURL 或 %s", cdnConfigFileName)
+		}
+		legacy, err := cdn.NewLegacy(cfg.cdnURL, cfg.cdnAuth)
+		if err != nil {
+			return nil, fmt.Errorf("CDN 配置无效: %v", err)
+		}
+		p.cdnProviders = []cdn.Provider{legacy}
+	} else if err != nil {
+		return nil, fmt.Errorf("%s 加载失败: %v", cdnConfigFileName, err)
+	}
+	if cfg.loginReload == loginreload.MethodAdmin {
+		p.reloader = &loginreload.Admin{
+			Endpoints: cfg.loginAdminEndpoints,
+			Command:   cfg.loginAdminCommand,
+			Ack:       cfg.loginAdminAck,
+		}
+	} else {
+		p.reloader = &loginreload.Playbook{Layout: cfg.gameLayout, BookPath: loginBookPath}
+	}
+
+	getsomething.ValidGameList(dir, gameListFileName)
+	p.ipMap, p.ipGroup = getsomething.LoadIpMap(dir, gameListFileName)
+	p.portMap = getsomething.LoadPortMap(dir, gameListFileName)
+	p.loginSlice = getsomething.GetLoginSlice(dir, loginListFileName)
+	p.currentNum = getsomething.GetCurrentGameNum(dir, initFileName)
+
+	p.runLogPath = filepath.Join(currentDir, runLogDir, name)
+
+	p.history, err = history.Open(filepath.Join(currentDir, historyDir, name))
+	if err != nil {
+		return nil, err
+	}
+	p.samples, err = p.history.Load(p.currentNum)
+	if err != nil {
+		return nil, err
+	}
+	p.status = projectStatus{Project: name, CurrentNum: p.currentNum}
+
+	if cfg.artifactPin != "" {
+		meta, err := artifacts.Get(cfg.artifactPin)
+		if err != nil {
+			return nil, err
+		}
+		p.Info.Printf("安装包版本固定为: %s", meta.Version())
+	}
+
+	p.daemonState, err = state.Load(filepath.Join(dir, stateFileName))
+	if err != nil {
+		return nil, fmt.Errorf("状态文件加载失败: %v", err)
+	}
+	if err = p.adoptPendingReloads(); err != nil {
+		return nil, fmt.Errorf("记录待补齐登录服失败: %v", err)
+	}
+
+	p.db = &logdb.Client{
+		Options:      cfg.logDB,
+		MaxBackoff:   cfg.logDBMaxBackoff,
+		OutageNotify: cfg.logDBOutageNotify,
+		Notifier:     cfg.notifier,
+		Label:        name,
+		Loggers:      p.Loggers,
+	}
+	if _, err = p.db.DB(); err != nil {
+		p.Warn.Printf("日志库暂不可用, 将在后台重连: %v", err)
+	}
+
+	// SQL 来源复用项目的日志库连接，需在 p.db 创建之后构造
+	switch cfg.onlineSource {
+	case online.SourceSQL:
+		p.online = &online.SQL{DB: p.db, Query: cfg.onlineSQL}
+	case online.SourceHTTP:
+		p.online = &online.HTTP{URL: cfg.onlineURL, Field: cfg.onlineField}
+	}
+	return p, nil
+}
+
+// run 运行项目的监控循环，直到没有待配置的 game。
+// 循环 panic 时只影响本项目，记录后等待 panicRestartDelay 重新启动循环，不退出进程
+func (p *project) run() {
+	defer p.db.Close()
+	for !p.runLoop() {
+		p.Warn.Printf("监控循环 %s 后重新启动", panicRestartDelay)
+		time.Sleep(panicRestartDelay)
+	}
+}
+
+// runLoop 运行一次监控循环，正常结束时返回 true，panic 时记录、发送通知并返回 false
+func (p *project) runLoop() (finished bool) {
+	defer func() {
+		if err := recover(); err != nil {
+			p.Err.Printf("Panic occurred: %v\nStack: %s", err, debug.Stack())
+			msg := fmt.Sprintf("监控循环异常: %v, %s 后重新启动", err, panicRestartDelay)
+			if p.name != "" {
+				msg = fmt.Sprintf("[%s] %s", p.name, msg)
+			}
+			notify.Send(p.notifier, msg)
+			finished = false
+		}
+	}()
+	p.mainLoop()
+	return true
+}
+
+func (p *project) mainLoop() {
+	for {
+		p.resyncStragglers()
+		initFilePath := filepath.Join(p.dir, initFileName)
+
+		// 日志库不可用时指标不可用，暂停开服判断，等待后台重连
+		db, err := p.db.DB()
+		if err != nil {
+			p.Warn.Printf("指标不可用, 暂停开服判断: %v", err)
+			time.Sleep(30 * time.Second)
+			continue
+		}
+
+		registerCount, err := execute.QueryCount(db, registerCountSql, p.currentNum)
+		if err != nil {
+			p.Warn.Printf("查询注册人数失败: %v", err)
+			time.Sleep(time.Duration(30) * time.Second)
+			continue
+		}
+		p.Info.Printf("当前注册人数 %d / %d, game 编号: %d", registerCount, p.criticalRegisterCount, p.currentNum)
+
+		nextNum := p.currentNum + 1
+		if !getsomething.ValidNextServer(nextNum, p.ipMap) {
+			p.Info.Printf("待配置 game%d 不存在，停止监控\n", nextNum)
+			return
+		}
+
+		rechargeCount, err := execute.QueryCount(db, rechargeCountSql, p.currentNum, p.criticalMoney)
+		if err != nil {
+			p.Warn.Printf("查询付费人数失败: %v", err)
+			time.Sleep(time.Minute)
+			continue
+		}
+		p.Info.Printf("当前付费人数 %d / %d, 付费临界值: %d, game 编号: %d", rechargeCount, p.criticalRechargeCount, p.criticalMoney, p.currentNum)
+		// 在线人数查询失败时只跳过在线人数规则，不影响其他规则
+		var onlineCount *int
+		if p.online != nil {
+			if count, err := p.online.Count(p.currentNum); err != nil {
+				p.Warn.Printf("查询在线人数失败: %v", err)
+			} else {
+				onlineCount = &count
+				p.Info.Printf("当前在线人数 %d / %d, game 编号: %d", count, p.criticalOnline, p.currentNum)
+			}
+		}
+		p.recordSample(registerCount, rechargeCount, onlineCount)
+
+		// 达到临界值，或按注册速率预计很快达到临界值
+		if registerCount >= p.criticalRegisterCount || rechargeCount >= p.criticalRechargeCount ||
+			p.onlineReached(onlineCount, 100) || p.rateTriggered(registerCount) {
+			if p.handleServerSwitch(p.currentNum, nextNum) {
+				if err = execute.UpdateServerNum(nextNum, initFilePath); err != nil {
+					p.Err.Printf("更新game本地编号文件失败: %v", err)
+				} else {
+					p.switchTo(nextNum)
+				}
+			} else {
+				p.Err.Printf("game 编号: %d 开服期间出现异常\n", nextNum)
+				time.Sleep(time.Minute)
+			}
+			continue
+		}
+
+		// 达到预装阈值
+		if p.shouldPrewarm(registerCount, rechargeCount, onlineCount, nextNum) {
+			p.prewarmGame(nextNum)
+		}
+
+		time.Sleep(30 * time.Second)
+	}
+}
+
+// recordSample 保存本轮查询到的指标，计算注册速率并更新状态接口的数据
+func (p *project) recordSample(registerCount, rechargeCount int, onlineCount *int) {
+	sample := history.Sample{Time: time.Now(), Num: p.currentNum, Register: registerCount, Payers: rechargeCount, Online: onlineCount}
+	if err := p.history.Append(sample); err != nil {
+		p.Warn.Printf("保存采样失败: %v", err)
+	}
+	p.samples = append(p.samples, sample)
+	p.samples = history.Since(p.samples, sample.Time, p.rateWindow)
+
+	rate, ok := history.Rate(p.samples, p.rateWindow)
+	if ok {
+		p.Info.Printf("最近 %s 注册速率 %.1f 人/分钟, game 编号: %d", p.rateWindow, rate, p.currentNum)
+	}
+	p.statusMu.Lock()
+	defer p.statusMu.Unlock()
+	p.status.CurrentNum = p.currentNum
+	p.status.Register = registerCount
+	p.status.Payers = rechargeCount
+	p.status.Online = onlineCount
+	p.status.SampledAt = sample.Time
+	p.status.RegisterRate = nil
+	if ok {
+		p.status.RegisterRate = &rate
+	}
+}
+
+// rateTriggered 按统计窗口内的注册速率预计注册人数在 rateTrigger 时间内达到临界值时返回 true。
+// 采样跨度不足半个统计窗口时速率不可信，不触发。
+func (p *project) rateTriggered(registerCount int) bool {
+	if p.rateTrigger <= 0 || history.Span(p.samples, p.rateWindow) < p.rateWindow/2 {
+		return false
+	}
+	rate, ok := history.Rate(p.samples, p.rateWindow)
+	if !ok || rate <= 0 {
+		return false
+	}
+	remaining := float64(p.criticalRegisterCount - registerCount)
+	if remaining > rate*p.rateTrigger.Minutes() {
+		return false
+	}
+	p.Info.Printf("注册速率 %.1f 人/分钟, 预计 %.1f 分钟后达到注册人数临界值 %d, 提前开服",
+		rate, remaining/rate, p.criticalRegisterCount)
+	return true
+}
+
+// switchTo 开服成功后切换到新 game，采样从新 game 重新开始
+func (p *project) switchTo(num int) {
+	p.currentNum = num
+	p.samples = nil
+	p.statusMu.Lock()
+	defer p.statusMu.Unlock()
+	p.status = projectStatus{Project: p.name, CurrentNum: num}
+}
+
+// onlineReached 判断在线人数是否达到临界值的 percent%，未配置在线人数临界值或本轮查询失败时返回 false
+func (p *project) onlineReached(onlineCount *int, percent int) bool {
+	return onlineCount != nil && p.criticalOnline > 0 && *onlineCount*100 >= p.criticalOnline*percent
+}
+
+// shouldPrewarm 判断是否达到预装阈值，仅 auto 模式且 prewarmPercent 大于 0 时生效
+func (p *project) shouldPrewarm(registerCount, rechargeCount int, onlineCount *int, nextNum int) bool {
+	if p.workMode != "auto" || p.prewarmPercent <= 0 || time.Now().Before(p.prewarmRetry) {
+		return false
+	}
+	var prewarmed int
+	p.daemonState.Get(func(s *state.State) { prewarmed = s.Prewarmed })
+	if prewarmed == nextNum || p.daemonState.Installed(nextNum) {
+		return false
+	}
+	return registerCount*100 >= p.criticalRegisterCount*p.prewarmPercent ||
+		rechargeCount*100 >= p.criticalRechargeCount*p.prewarmPercent ||
+		p.onlineReached(onlineCount, p.prewarmPercent)
+}
+
+// prewarmGame 提前安装并启动下一个 game，此时编号仍在白名单中，对玩家不可见
+func (p *project) prewarmGame(num int) {
+	p.Info.Printf("达到预装阈值 %d%%, 开始预装 game 编号: %d", p.prewarmPercent, num)
+	run, err := runlog.Start(p.runLogPath, fmt.Sprintf("prewarm-game%d", num), p.runLogKeep)
+	if err != nil {
+		p.Err.Printf("game 编号: %d 创建运行日志失败: %v", num, err)
+		return
+	}
+	if !p.preflightCheck(run, num, true) {
+		p.Err.Printf("game 编号: %d 预装前检查未通过, 10 分钟后重试, 执行过程见 %s", num, run.Dir)
+		p.prewarmRetry = time.Now().Add(10 * time.Minute)
+		return
+	}
+	if err = p.hideGame(run); err != nil {
+		p.Err.Printf("game 编号: %d 未能确认在所有登录服白名单中, 不预装, 10 分钟后重试, 执行过程见 %s: %v", num, run.Dir, err)
+		p.prewarmRetry = time.Now().Add(10 * time.Minute)
+		return
+	}
+	err = p.installGame(run, p.currentNum, num)
+	if err != nil {
+		p.Err.Printf("game 编号: %d 预装失败, 10 分钟后重试, 执行过程见 %s: %v", num, run.Dir, err)
+		p.prewarmRetry = time.Now().Add(10 * time.Minute)
+		return
+	}
+	if err = p.daemonState.Update(func(s *state.State) { s.Prewarmed = num }); err != nil {
+		p.Err.Printf("记录预装状态失败: %v", err)
+	}
+	p.Success.Printf("game 编号: %d 预装完成, 执行过程见 %s", num, run.Dir)
+}
+
+// hideGame 预装前将所有登录服上的白名单同步为当前 game 开服后的期望内容，未开的 game 均在白名单中，
+// 名单有变更的登录服立即重载。首次部署或白名单被手工修改过时，避免预装的 game 启动后对玩家可见。
+// 任一登录服失败都返回错误，不按多数派策略放行。
+func (p *project) hideGame(run *runlog.Run) error {
+	results := execute.ForEachLogin(p.loginSlice, p.loginParallel, func(host string) error {
+		changed, err := lists.Sync(run, host, p.gameLayout, lists.White, p.inventory(), p.currentNum)
+		if err != nil || !changed {
+			return err
+		}
+		if err = p.reloader.Reload(run, host); err != nil {
+			// 名单已写入但未生效，由下一次重载补上
+			p.markReload(host)
+			return err
+		}
+		return nil
+	})
+	return results.Check(execute.QuorumAll)
+}
+
+// gamePort 按分配策略计算 game 端口，已记录在状态文件中的端口优先
+func (p *project) gamePort(num int) (int, error) {
+	allocator := &portalloc.Allocator{
+		Strategy: p.portStrategy,
+		Base:     p.portBase,
+		Step:     p.portStep,
+		IPMap:    p.ipMap,
+		Explicit: p.portMap,
+		Recorded: p.daemonState.RecordedPorts(),
+	}
+	return allocator.Port(num)
+}
+
+// installGame 部署 game 并在状态文件中记录使用的端口和安装包版本
+func (p *project) installGame(run *runlog.Run, oldNum, newNum int) error {
+	port, err := p.gamePort(newNum)
+	if err != nil {
+		return err
+	}
+	if p.gameDBProvision {
+		err = gamedb.Provision(gamedb.Options{
+			Host:          p.installExamples.gameDBHost,
+			User:          p.installExamples.gameDBUser,
+			Password:      p.installExamples.gameDBPassword,
+			AdminUser:     p.gameDBAdminUser,
+			AdminPassword: p.gameDBAdminPassword,
+			DBName:        p.gameLayout.DBName(newNum),
+			MigrationDir:  filepath.Join(basePath, sqlDir),
+		})
+		if err != nil {
+			return fmt.Errorf("game 数据库准备失败: %v", err)
+		}
+	}
+	meta, err := p.installPackage(run, oldNum)
+	if err != nil {
+		return err
+	}
+	if err = artifacts.Verify(meta); err != nil {
+		return err
+	}
+	cfg := p.installExamples.gameConfig()
+	cfg.Port = port
+	err = execute.InstallGame(run, p.gameLayout, newNum, artifacts.Path(meta),
+		filepath.Join(basePath, installYamlFileName), p.ipMap, p.ipGroup, cfg)
+	if err != nil {
+		return err
+	}
+	p.Info.Printf("game 编号: %d 部署的安装包版本: %s", newNum, meta.Version())
+	if err = p.daemonState.RecordVersion(newNum, meta.SHA256); err != nil {
+		p.Err.Printf("记录 game 编号: %d 安装包版本失败: %v", newNum, err)
+	}
+	if err = p.daemonState.RecordPort(newNum, port); err != nil {
+		p.Err.Printf("记录 game 编号: %d 端口失败: %v", newNum, err)
+	}
+	return nil
+}
+
+// installPackage 返回本次部署使用的安装包。
+// 配置了 artifactPin 时使用仓库中的指定版本，配置了 releasePackage 时使用发布包，否则从旧 game 拉取
+func (p *project) installPackage(run *runlog.Run, oldNum int) (*artifact.Meta, error) {
+	if p.artifactPin != "" {
+		return artifacts.Get(p.artifactPin)
+	}
+	if p.releasePackage != "" {
+		p.Info.Printf("正在导入发布包: %s", p.releasePackage)
+		return artifacts.Import(p.releasePackage)
+	}
+	packageFile, err := execute.FetchPackage(run, p.gameLayout, oldNum, filepath.Join(basePath, packageYamlFileName), p.ipMap)
+	if err != nil {
+		return nil, err
+	}
+	return artifacts.Put(packageFile, oldNum)
+}
+
+// 包装函数
+func (p *project) cleanLogsWrapper(run *runlog.Run, num int) error {
+	return execute.CleanLogs(run, p.gameLayout, num, p.ipMap)
+}
+
+func (p *project) updateOpenTimeWrapper(run *runlog.Run, num int) error {
+	return execute.UpdateOpenTime(run, p.gameLayout, num, p.ipMap, openBookPath)
+}
+
+func (p *project) updateWhitelistWrapper(run *runlog.Run, num int) error {
+	return p.updateList(run, lists.White, num)
+}
+
+func (p *project) updateLimitWrapper(run *runlog.Run, num int) error {
+	return p.updateList(run, lists.Limit, num)
+}
+
+// updateList 并发将所有登录服上的名单同步为 openNum 开服后的期望内容，有变更的登录服记入待重载，由重载步骤统一重载
+func (p *project) updateList(run *runlog.Run, kind string, openNum int) error {
+	results := execute.ForEachLogin(p.loginSlice, p.loginParallel, func(host string) error {
+		changed, err := lists.Sync(run, host, p.gameLayout, kind, p.inventory(), openNum)
+		if changed {
+			p.markReload(host)
+		}
+		return err
+	})
+	return p.checkLogin(results, kind, openNum)
+}
+
+// reloadLoginWrapper 重载名单有变更的登录服，成功的登录服从待重载中移除
+// 白名单和限制名单之间有 sleepInterval 间隔时各重载一次，否则合并为一次
+func (p *project) reloadLoginWrapper(run *runlog.Run, num int) error {
+	hosts := p.daemonState.PendingReloads()
+	if len(hosts) == 0 {
+		p.Info.Printf("登录服名单均无变更，无需重载")
+		return nil
+	}
+
+	results := execute.ForEachLogin(hosts, p.loginParallel, func(host string) error {
+		return p.reloader.Reload(run, host)
+	})
+	var reloaded []string
+	for host, err := range results {
+		if err == nil {
+			reloaded = append(reloaded, host)
+		}
+	}
+	p.clearReload(reloaded...)
+	if err := p.checkLogin(results, opReload, num); err != nil {
+		return err
+	}
+	// 满足策略时失败的登录服已记为待补齐，由补齐流程重载
+	p.clearReload(results.Failed()...)
+	return nil
+}
+
+// markReload 将名单已变更的登录服记入状态文件中的待重载
+func (p *project) markReload(host string) {
+	if err := p.daemonState.MarkReload(host); err != nil {
+		p.Err.Printf("记录待重载登录服 %s 失败: %v", host, err)
+	}
+}
+
+// clearReload 从状态文件的待重载中移除登录服
+func (p *project) clearReload(hosts ...string) {
+	if len(hosts) == 0 {
+		return
+	}
+	if err := p.daemonState.ClearReload(hosts...); err != nil {
+		p.Err.Printf("清除待重载登录服失败: %v", err)
+	}
+}
+
+// adoptPendingReloads 上次运行中名单已写入但未确认重载的登录服转为待补齐，由补齐流程重载
+func (p *project) adoptPendingReloads() error {
+	hosts := p.daemonState.PendingReloads()
+	if len(hosts) == 0 {
+		return nil
+	}
+	p.Warn.Printf("登录服 %s 上次运行中名单已变更但未重载, 转为待补齐", strings.Join(hosts, ","))
+	stragglers := make([]state.Straggler, 0, len(hosts))
+	for _, host := range hosts {
+		stragglers = append(stragglers, state.Straggler{Host: host, Op: opReload, Num: p.currentNum})
+	}
+	// 先记录待补齐再清除待重载，中途退出时下次启动会重新转换，重复记录会被合并
+	if err := p.daemonState.AddStragglers(stragglers...); err != nil {
+		return err
+	}
+	return p.daemonState.ClearReload(hosts...)
+}
+
+// inventory 返回 game_list.txt 中的所有 game 编号
+func (p *project) inventory() []int {
+	var nums []int
+	for _, list := range p.ipMap {
+		for _, s := range list {
+			if num, err := strconv.Atoi(s); err == nil {
+				nums = append(nums, num)
+			}
+		}
+	}
+	return nums
+}
+
+// checkLogin 按策略判断登录服更新结果，满足策略但有失败时把失败的登录服记入状态文件，由后续循环补齐，
+// 重试开服或多次失败时同一登录服的同一操作只记录一条
+func (p *project) checkLogin(results execute.LoginResults, op string, num int) error {
+	if err := results.Check(p.loginQuorum); err != nil {
+		return err
+	}
+	failed := results.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+	stragglers := make([]state.Straggler, 0, len(failed))
+	for _, host := range failed {
+		stragglers = append(stragglers, state.Straggler{Host: host, Op: op, Num: num})
+	}
+	if err := p.daemonState.AddStragglers(stragglers...); err != nil {
+		p.Err.Printf("记录待补齐登录服失败: %v", err)
+	}
+	return nil
+}
+
+// resyncStragglers 补齐之前更新失败的登录服，失败时保留记录，每 5 分钟最多尝试一次
+func (p *project) resyncStragglers() {
+	if time.Now().Before(p.resyncAfter) {
+		return
+	}
+	var pending []state.Straggler
+	p.daemonState.Get(func(s *state.State) { pending = append(pending, s.Stragglers...) })
+	if len(pending) == 0 {
+		return
+	}
+	p.resyncAfter = time.Now().Add(resyncInterval)
+
+	// 补齐失败时每 5 分钟产生一个运行目录，单独保存和清理，避免挤掉失败开服的运行日志
+	run, err := runlog.Start(filepath.Join(p.runLogPath, resyncRunLogDir), "resync-login", p.runLogKeep)
+	if err != nil {
+		p.Err.Printf("创建运行日志失败: %v", err)
+		return
+	}
+	for _, st := range pending {
+		// 按当前最新已开的 game 计算期望内容，期间可能已经又开了新 game
+		err = nil
+		if st.Op != opReload {
+			_, err = lists.Sync(run, st.Host, p.gameLayout, st.Op, p.inventory(), p.currentNum)
+		}
+		if err == nil {
+			err = p.reloader.Reload(run, st.Host)
+		}
+		if err != nil {
+			p.Warn.Printf("登录服 %s 补齐%s失败, 执行过程见 %s: %v", st.Host, opName(st.Op), run.Dir, err)
+			continue
+		}
+		p.Success.Printf("登录服 %s 已补齐%s", st.Host, opName(st.Op))
+		done := st
+		err = p.daemonState.Update(func(s *state.State) {
+			for i, other := range s.Stragglers {
+				if other == done {
+					s.Stragglers = append(s.Stragglers[:i], s.Stragglers[i+1:]...)
+					break
+				}
+			}
+		})
+		if err != nil {
+			p.Err.Printf("清除待补齐记录失败: %v", err)
+		}
+	}
+}
+
+func (p *project) flushCDNWrapper(_ *runlog.Run, num int) error {
+	report := cdn.FlushCDN(num, p.cdnProviders)
+	var failed []string
+	for _, c := range report.Checks {
+		if c.Err != nil {
+			failed = append(failed, c.Target)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("CDN 端点 %s 刷新失败", strings.Join(failed, ","))
+	}
+	return nil
+}
+
+// verifyCDNWrapper 轮询区服列表，确认新 game 已对客户端可见
+// 每次轮询最长 serverListTimeout，超时后重新刷新一次 CDN 再轮询，不经过 executeWithRetry，
+// 最长耗时约为 2 * serverListTimeout 加一次 CDN 刷新的时间
+func (p *project) verifyCDNWrapper(run *runlog.Run, num int) error {
+	ip, err := getsomething.GetGameIP(num, p.ipMap)
+	if err != nil {
+		return err
+	}
+	port, err := p.gamePort(num)
+	if err != nil {
+		return err
+	}
+	if err = p.serverList.Verify(num, ip, port); err == nil {
+		return nil
+	}
+	p.Warn.Printf("区服列表中未出现 game 编号: %d, 重新刷新 CDN 后再验证一次: %v", num, err)
+	if err = p.flushCDNWrapper(run, num); err != nil {
+		return err
+	}
+	return p.serverList.Verify(num, ip, port)
+}
+
+func updateSleepTimeWrapper(_ *runlog.Run, i int) error {
+	return execute.UpdateSleepTime(i)
+}
+
+func (p *project) handleServerSwitch(oldNum, newNum int) bool {
+	if !getsomething.ValidNextServer(newNum, p.ipMap) {
+		p.Err.Printf("待配置 game%d 为不存在: \n", newNum)
+		return false
+	}
+	run, err := runlog.Start(p.runLogPath, fmt.Sprintf("game%d", newNum), p.runLogKeep)
+	if err != nil {
+		p.Err.Printf("game 编号: %d 创建运行日志失败: %v", newNum, err)
+		p.abortSwitch(nil, newNum, "创建运行日志", err)
+		return false
+	}
+	var prewarmed int
+	p.daemonState.Get(func(s *state.State) { prewarmed = s.Prewarmed })
+	// 上一次开服在部署之后的步骤失败时 game 已部署并启动，重试时跳过安装，否则端口检查总是失败
+	installed := p.daemonState.Installed(newNum)
+	install := p.workMode == "auto" && prewarmed != newNum && !installed
+	if prewarmed == newNum {
+		p.Info.Printf("game 编号: %d 已预装，跳过安装", newNum)
+	} else if installed {
+		p.Info.Printf("game 编号: %d 已部署，跳过安装", newNum)
+	}
+
+	if !p.preflightCheck(run, newNum, install) {
+		p.Err.Printf("game 编号: %d 开服前检查未通过，未做任何变更, 执行过程见 %s", newNum, run.Dir)
+		p.abortSwitch(run, newNum, "开服前检查", errors.New("开服前检查未通过，未做任何变更"))
+		return false
+	}
+	if !lists.ReportDrift(run, p.loginSlice, p.gameLayout) {
+		p.Warn.Printf("登录服名单不一致，开服时将按期望内容覆盖, 执行过程见 %s", run.Dir)
+	}
+	if install {
+		err = p.installGame(run, p.currentNum, newNum)
+		if err != nil {
+			p.Err.Printf("game 编号: %d 部署失败, 执行过程见 %s: %v", newNum, run.Dir, err)
+			p.abortSwitch(run, newNum, "部署", err)
+			return false
+		}
+	}
+
+	type step struct {
+		name    string
+		fn      func(*runlog.Run, int) error
+		arg     int
+		noRetry bool // 步骤自身已包含等待和重试
+	}
+	ops := []step{
+		{name: "清理日志", fn: p.cleanLogsWrapper, arg: newNum},
+		{name: "开服时间", fn: p.updateOpenTimeWrapper, arg: newNum},
+		{name: "白名单更新", fn: p.updateWhitelistWrapper, arg: newNum},
+	}
+	// 旧 game 在新 game 对客户端可见并经过 sleepInterval 后才限制创建，
+	// 间隔为 0 时没有宽限期，两个名单合并为一次重载
+	if p.sleepInterval == 0 {
+		ops = append(ops, step{name: "限制名单", fn: p.updateLimitWrapper, arg: newNum})
+	}
+	ops = append(ops,
+		step{name: "重载登录服", fn: p.reloadLoginWrapper, arg: newNum},
+		step{name: "CDN刷新", fn: p.flushCDNWrapper, arg: newNum},
+	)
+	if p.serverList != nil {
+		ops = append(ops, step{name: "CDN验证", fn: p.verifyCDNWrapper, arg: newNum, noRetry: true})
+	}
+	if p.sleepInterval > 0 {
+		ops = append(ops,
+			step{name: "休眠间隔", fn: updateSleepTimeWrapper, arg: p.sleepInterval},
+			step{name: "限制名单", fn: p.updateLimitWrapper, arg: newNum},
+			step{name: "重载登录服(限制名单)", fn: p.reloadLoginWrapper, arg: newNum},
+		)
+	}
+
+	for _, op := range ops {
+		if op.noRetry {
+			p.Info.Printf("执行 %s", op.name)
+			if err = op.fn(run, op.arg); err == nil {
+				p.Success.Printf("任务 %s 成功", op.name)
+			}
+		} else {
+			err = p.executeWithRetry(run, op.name, op.fn, op.arg)
+		}
+		if err != nil {
+			p.Err.Printf("任务 %s 失败, 中止开服, 执行过程见 %s", op.name, run.Dir)
+			p.abortSwitch(run, newNum, op.name, err)
+			return false
+		}
+	}
+	if prewarmed == newNum {
+		if err = p.daemonState.Update(func(s *state.State) { s.Prewarmed = 0 }); err != nil {
+			p.Err.Printf("清除预装状态失败: %v", err)
+		}
+	}
+	p.verifyOpen(run, oldNum, newNum)
+	p.Success.Printf("game 编号: %d 开服完成, 执行过程见 %s", newNum, run.Dir)
+	return true
+}
+
+// verifyOpen 开服后验证，只报告结果，变更已全部完成，不影响开服结果
+func (p *project) verifyOpen(run *runlog.Run, oldNum, newNum int) {
+	ip, err := getsomething.GetGameIP(newNum, p.ipMap)
+	if err != nil {
+		p.Err.Printf("%v", err)
+		return
+	}
+	port, err := p.gamePort(newNum)
+	if err != nil {
+		p.Err.Printf("%v", err)
+		return
+	}
+	report := verify.Run(run, verify.Options{
+		GameNum:   newNum,
+		PrevNum:   oldNum,
+		GameIP:    ip,
+		GamePort:  port,
+		Probe:     p.verifyProbe,
+		LoginIPs:  p.loginSlice,
+		WhitePath: p.gameLayout.WhitePath(),
+		LimitPath: p.gameLayout.LimitPath(),
+	})
+	if report.Failed() {
+		p.Err.Printf("game 编号: %d 开服后验证未通过，请人工确认, 执行过程见 %s", newNum, run.Dir)
+	}
+}
+
+func (p *project) preflightCheck(run *runlog.Run, num int, install bool) bool {
+	ip, err := getsomething.GetGameIP(num, p.ipMap)
+	if err != nil {
+		p.Err.Printf("%v", err)
+		return false
+	}
+	port, err := p.gamePort(num)
+	if err != nil {
+		p.Err.Printf("端口分配失败: %v", err)
+		return false
+	}
+	// 开启数据库准备时数据库在安装前才创建，这里只检查数据库服务
+	dbName := p.gameLayout.DBName(num)
+	if install && p.gameDBProvision {
+		dbName = ""
+	}
+	report := preflight.Run(run, preflight.Options{
+		GameNum:    num,
+		GameIP:     ip,
+		LoginIPs:   p.loginSlice,
+		GameDir:    p.gameLayout.GameDirOf(num),
+		Install:    install,
+		GamePort:   port,
+		DataDir:    p.gameLayout.DataDir,
+		MinFreeMB:  p.preflightMinFreeMB,
+		DBHost:     p.installExamples.gameDBHost,
+		DBUser:     p.installExamples.gameDBUser,
+		DBPassword: p.installExamples.gameDBPassword,
+		DBName:     dbName,
+	})
+	return !report.Failed()
+}
+
+func (p *project) executeWithRetry(run *runlog.Run, opName string, fn func(*runlog.Run, int) error, arg int) error {
+	const maxRetries = 3
+	const maxDelay = 10 * time.Second
+	var lastErr error
+
+	for attempt := 1; attempt <= maxRetries; attempt++ {
+		p.Info.Printf("执行 %s (尝试 %d/%d)", opName, attempt, maxRetries)
+
+		if err := fn(run, arg); err != nil {
+			lastErr = err
+			p.Warn.Printf("%s 尝试 %d 失败: %v", opName, attempt, err)
+			if attempt < maxRetries {
+				delay := time.Duration(attempt*attempt) * time.Second
+				if delay > maxDelay {
+					delay = maxDelay
+				}
+				p.Warn.Printf("%s 等待 %v 后重试...", opName, delay)
+				time.Sleep(delay)
+			}
+			continue
+		}
+
+		p.Success.Printf("任务 %s 成功", opName)
+		return nil
+	}
+
+	p.Err.Printf("任务 %s 失败 (共尝试 %d 次)，最后错误: %v", opName, maxRetries, lastErr)
+	return lastErr
+}
+
+// abortSwitch 记录开服中止的原因供状态接口读取并发送通知，ansible 失败时带上出错的任务和主机
+func (p *project) abortSwitch(run *runlog.Run, num int, stepName string, err error) {
+	failure := &switchFailure{Num: num, Step: stepName, LastError: redact.String(err.Error()), At: time.Now()}
+	if ae := execute.AsAnsibleError(err); ae != nil {
+		failure.FailedTask = ae.Task
+		failure.Host = ae.Host
+	}
+	if run != nil {
+		failure.RunDir = run.Dir
+	}
+	p.statusMu.Lock()
+	p.status.LastFailure = failure
+	p.statusMu.Unlock()
+
+	msg := fmt.Sprintf("game%d 开服中止, 步骤: %s", num, stepName)
+	if p.name != "" {
+		msg = fmt.Sprintf("[%s] %s", p.name, msg)
+	}
+	if failure.FailedTask != "" {
+		msg += fmt.Sprintf(", 任务: [%s], 主机: %s", failure.FailedTask, failure.Host)
+	}
+	msg += ", 错误: " + failure.LastError
+	if failure.RunDir != "" {
+		msg += ", 执行过程见 " + failure.RunDir
+	}
+	notify.Send(p.notifier, msg)
+}
@@ -0,0 +1,127 @@
+package redact
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Mask 替换密钥的内容。
+const Mask = "******"
+
+var (
+	mu       sync.RWMutex
+	secrets  = make(map[string]bool)
+	envKeys  = make(map[string]bool)
+	replacer = strings.NewReplacer()
+)
+
+// Register 登记需要在日志和命令输出中屏蔽的密钥值，空值会被忽略。
+// 过短的值（例如 root、123456）同样屏蔽，正常日志中相同的内容也会显示为 Mask。
+func Register(values ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	changed := false
+	for _, v := range values {
+		if v != "" && !secrets[v] {
+			secrets[v] = true
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+
+	// 长的优先，避免一个密钥是另一个密钥的子串时只替换一部分
+	list := make([]string, 0, len(secrets))
+	for v := range secrets {
+		list = append(list, v)
+	}
+	sort.Slice(list, func(i, j int) bool { return len(list[i]) > len(list[j]) })
+	pairs := make([]string, 0, len(list)*2)
+	for _, v := range list {
+		pairs = append(pairs, v, Mask)
+	}
+	replacer = strings.NewReplacer(pairs...)
+}
+
+// String 将 s 中已登记的密钥替换为 Mask。
+func String(s string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return replacer.Replace(s)
+}
+
+// RegisterEnv 登记保存密钥的环境变量名，Env 会从子进程环境中去掉这些变量。
+func RegisterEnv(keys ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, key := range keys {
+		envKeys[key] = true
+	}
+}
+
+// Env 返回去掉已登记的密钥环境变量后的副本，用于子进程环境。按变量名过滤，不按值过滤，
+// 否则值恰好包含密钥的 HOME、PATH 等变量也会被去掉。
+// 参数:
+//
+//	env: KEY=VALUE 形式的环境变量，通常为 os.Environ()。
+//
+// 返回值:
+//
+//	[]string: 过滤后的环境变量。
+func Env(env []string) []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	filtered := make([]string, 0, len(env))
+	for _, kv := range env {
+		key, _, _ := strings.Cut(kv, "=")
+		if envKeys[key] {
+			continue
+		}
+		filtered = append(filtered, kv)
+	}
+	return filtered
+}
+
+// Writer 按行屏蔽密钥后写入下层 Writer，密钥跨越多次 Write 时也能屏蔽。
+type Writer struct {
+	mu  sync.Mutex
+	w   io.Writer
+	buf []byte
+}
+
+// NewWriter 返回包装 w 的 Writer，不以换行结尾的内容需调用 Flush 写出。
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Write 缓存 p，每遇到换行就屏蔽并写出完整的行。
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	i := bytes.LastIndexByte(w.buf, '\n')
+	if i < 0 {
+		return len(p), nil
+	}
+	if _, err := io.WriteString(w.w, String(string(w.buf[:i+1]))); err != nil {
+		return 0, err
+	}
+	w.buf = append(w.buf[:0], w.buf[i+1:]...)
+	return len(p), nil
+}
+
+// Flush 屏蔽并写出缓存中剩余的内容。
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(w.w, String(string(w.buf)))
+	w.buf = w.buf[:0]
+	return err
+}
@@ -0,0 +1,119 @@
+package render
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	ServerAppFileName = "server.app.lua"
+	ZonesFileName     = "zones.lua"
+	OpenTimeFileName  = "open_time.lua"
+)
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+var templates = template.Must(template.New("").
+	Funcs(template.FuncMap{"lua": luaString}).
+	ParseFS(templateFS, "templates/*.tmpl"))
+
+// Discover 服务发现（zookeeper）地址。
+type Discover struct {
+	IP   string
+	Port int
+}
+
+// GameDB game 数据库连接信息。
+type GameDB struct {
+	Name     string
+	Host     string
+	User     string
+	Password string
+}
+
+// GameConfig 生成单个 game 配置文件所需的全部数据。
+type GameConfig struct {
+	Domain       string
+	IP           string
+	Port         int
+	Thread       int
+	Discovers    []Discover
+	GameDB       GameDB
+	GroupID      int
+	AreaID       int
+	GameIndexNum int
+	PayNotifyURL string
+}
+
+// OpenTime 返回开服时间字符串，取当前小时的第 1 分钟，与原 playbook 的 date +"%Y-%m-%dT%H:01:00" 一致。
+func OpenTime(t time.Time) string {
+	return t.Format("2006-01-02T15") + ":01:00"
+}
+
+// WriteGameConfig 生成 server.app.lua、zones.lua 和 open_time.lua 到 dir 目录。
+// 参数:
+//
+//	dir: 输出目录，不存在时创建。
+//	cfg: game 配置数据。
+//	openTime: 开服时间。
+//
+// 返回值:
+//
+//	error: 如果模板渲染或文件写入失败，返回错误信息；否则返回 nil。
+func WriteGameConfig(dir string, cfg GameConfig, openTime time.Time) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("创建配置目录失败: %v", err)
+	}
+	if err := writeTemplate(dir, ServerAppFileName, cfg); err != nil {
+		return err
+	}
+	if err := writeTemplate(dir, ZonesFileName, cfg); err != nil {
+		return err
+	}
+	return WriteOpenTime(dir, openTime)
+}
+
+// WriteOpenTime 生成 open_time.lua 到 dir 目录。
+// 参数:
+//
+//	dir: 输出目录，不存在时创建。
+//	openTime: 开服时间。
+//
+// 返回值:
+//
+//	error: 如果模板渲染或文件写入失败，返回错误信息；否则返回 nil。
+func WriteOpenTime(dir string, openTime time.Time) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("创建配置目录失败: %v", err)
+	}
+	return writeTemplate(dir, OpenTimeFileName, struct{ OpenTime string }{OpenTime(openTime)})
+}
+
+// writeTemplate 渲染 name.tmpl 并写入 dir/name，文件中可能包含数据库密码，权限为 0600。
+func writeTemplate(dir, name string, data interface{}) error {
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, name+".tmpl", data); err != nil {
+		return fmt.Errorf("渲染 %s 失败: %v", name, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0600); err != nil {
+		return fmt.Errorf("写入 %s 失败: %v", name, err)
+	}
+	return nil
+}
+
+// luaString 将字符串转为 Lua 双引号字符串字面量。
+func luaString(s string) string {
+	return `"` + strings.NewReplacer(
+		`\`, `\\`,
+		`"`, `\"`,
+		"\n", `\n`,
+		"\r", `\r`,
+	).Replace(s) + `"`
+}
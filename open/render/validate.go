@@ -0,0 +1,186 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+var (
+	utf8BOM       = []byte{0xEF, 0xBB, 0xBF}
+	discoverRegex = regexp.MustCompile(`^tcp://[^:/]+:\d+$`)
+)
+
+// ValidateGameConfig 在发布前用内置 Lua 解释器执行生成的配置，检查必需的全局变量和小区唯一性断言。
+// 参数:
+//
+//	dir: 配置文件所在目录，即 WriteGameConfig 的输出目录。
+//	areaID: 期望的区域编号。
+//
+// 返回值:
+//
+//	error: 如果语法错误、缺少必需变量或断言失败，返回错误信息；否则返回 nil。
+func ValidateGameConfig(dir string, areaID int) error {
+	if err := validateServerApp(filepath.Join(dir, ServerAppFileName), areaID); err != nil {
+		return fmt.Errorf("%s 校验失败: %v", ServerAppFileName, err)
+	}
+	if err := validateZones(filepath.Join(dir, ZonesFileName), areaID); err != nil {
+		return fmt.Errorf("%s 校验失败: %v", ZonesFileName, err)
+	}
+	if err := validateOpenTime(filepath.Join(dir, OpenTimeFileName)); err != nil {
+		return fmt.Errorf("%s 校验失败: %v", OpenTimeFileName, err)
+	}
+	return nil
+}
+
+func validateServerApp(path string, areaID int) error {
+	L, err := runFile(path)
+	if err != nil {
+		return err
+	}
+	defer L.Close()
+
+	for _, name := range []string{"domain", "ip"} {
+		if _, err = globalString(L, name); err != nil {
+			return err
+		}
+	}
+	for _, name := range []string{"port", "group_id"} {
+		if _, err = globalNumber(L, name); err != nil {
+			return err
+		}
+	}
+	area, err := globalNumber(L, "area_id")
+	if err != nil {
+		return err
+	}
+	if int(area) != areaID {
+		return fmt.Errorf("area_id 为 %d, 期望 %d", int(area), areaID)
+	}
+
+	gameDB, ok := L.GetGlobal("game_db").(*lua.LTable)
+	if !ok {
+		return fmt.Errorf("缺少全局变量 game_db 或类型不是 table")
+	}
+	for _, key := range []string{"name", "host", "user", "password"} {
+		if v, ok := gameDB.RawGetString(key).(lua.LString); !ok || v == "" {
+			return fmt.Errorf("game_db.%s 缺失或为空", key)
+		}
+	}
+
+	discovers, ok := L.GetGlobal("discovers").(*lua.LTable)
+	if !ok {
+		return fmt.Errorf("缺少全局变量 discovers 或类型不是 table")
+	}
+	if discovers.Len() == 0 {
+		return fmt.Errorf("discovers 为空")
+	}
+	for i := 1; i <= discovers.Len(); i++ {
+		v, ok := discovers.RawGetInt(i).(lua.LString)
+		if !ok || !discoverRegex.MatchString(string(v)) {
+			return fmt.Errorf("discovers[%d] 格式错误: %v", i, discovers.RawGetInt(i))
+		}
+	}
+	return nil
+}
+
+func validateZones(path string, areaID int) error {
+	// 执行时会运行文件中的小区唯一性 assert
+	L, err := runFile(path)
+	if err != nil {
+		return err
+	}
+	defer L.Close()
+
+	zones, ok := L.GetGlobal("zones").(*lua.LTable)
+	if !ok {
+		return fmt.Errorf("缺少全局变量 zones 或类型不是 table")
+	}
+	if _, ok = zones.RawGetInt(areaID).(*lua.LTable); !ok {
+		return fmt.Errorf("zones 中没有区域 %d", areaID)
+	}
+	return nil
+}
+
+func validateOpenTime(path string) error {
+	L, err := runFile(path)
+	if err != nil {
+		return err
+	}
+	defer L.Close()
+
+	ret, ok := L.Get(-1).(*lua.LTable)
+	if !ok {
+		return fmt.Errorf("返回值不是 table")
+	}
+	if v, ok := ret.RawGetString("open_server_time").(lua.LString); !ok || v == "" {
+		return fmt.Errorf("open_server_time 缺失或为空")
+	}
+	return nil
+}
+
+// newSandbox 创建只加载 base、table、string、math 库的 Lua 状态，不加载 os、io 等可以访问守护进程主机的库，
+// 同时移除 base 库中读取文件的 dofile、loadfile。require 替换为空函数，因为依赖的 etc/services 等文件只存在于目标机。
+func newSandbox() *lua.LState {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range []string{"dofile", "loadfile"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+	L.SetGlobal("require", L.NewFunction(func(*lua.LState) int { return 0 }))
+	return L
+}
+
+// runFile 在沙箱中执行 Lua 文件。
+func runFile(path string) (*lua.LState, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	content = bytes.TrimPrefix(content, utf8BOM)
+
+	L := newSandbox()
+	fn, err := L.Load(bytes.NewReader(content), filepath.Base(path))
+	if err != nil {
+		L.Close()
+		return nil, fmt.Errorf("语法错误: %v", err)
+	}
+	L.Push(fn)
+	if err = L.PCall(0, 1, nil); err != nil {
+		L.Close()
+		return nil, fmt.Errorf("执行失败: %v", err)
+	}
+	return L, nil
+}
+
+func globalString(L *lua.LState, name string) (string, error) {
+	v, ok := L.GetGlobal(name).(lua.LString)
+	if !ok || v == "" {
+		return "", fmt.Errorf("缺少全局变量 %s 或不是非空字符串", name)
+	}
+	return string(v), nil
+}
+
+func globalNumber(L *lua.LState, name string) (float64, error) {
+	v, ok := L.GetGlobal(name).(lua.LNumber)
+	if !ok {
+		return 0, fmt.Errorf("缺少全局变量 %s 或不是数字", name)
+	}
+	return float64(v), nil
+}
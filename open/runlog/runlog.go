@@ -0,0 +1,165 @@
+package runlog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"open/loglevel"
+	"open/redact"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const timeLayout = "20060102-150405"
+
+var (
+	infoLogger = loglevel.GetInfoLogger()
+	warnLogger = loglevel.GetWarnLogger()
+
+	unsafeChars = regexp.MustCompile(`[^\p{L}\p{N}._-]+`)
+)
+
+// Run 表示一次开服切换的运行目录，每个步骤的输出写入该目录下的独立文件。
+type Run struct {
+	Dir string
+
+	mu  sync.Mutex
+	seq int
+}
+
+// Start 在 baseDir 下创建本次运行目录，并清理超出保留数量的旧目录。
+// 参数:
+//
+//	baseDir: 运行日志根目录，例如 /open/runlog。
+//	name: 本次运行的名称，例如 game5。
+//	keep: 保留的运行目录数量，小于等于 0 表示不清理。
+//
+// 返回值:
+//
+//	*Run: 本次运行对象。
+//	error: 如果目录创建失败，返回错误信息；否则返回 nil。
+func Start(baseDir, name string, keep int) (*Run, error) {
+	dir := filepath.Join(baseDir, fmt.Sprintf("%s_%s", time.Now().Format(timeLayout), sanitize(name)))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建运行日志目录失败: %v", err)
+	}
+	if keep > 0 {
+		if err := Cleanup(baseDir, keep); err != nil {
+			warnLogger.Printf("清理旧运行日志失败: %v", err)
+		}
+	}
+	infoLogger.Printf("本次运行日志目录: %s", dir)
+	return &Run{Dir: dir}, nil
+}
+
+// Exec 执行命令，将 stdout/stderr 写入本次运行目录下的步骤文件，主日志只记录摘要和文件路径。
+// 参数:
+//
+//	step: 步骤名称，用于生成文件名。
+//	cmd: 待执行的命令，Stdout 和 Stderr 不能提前设置。
+//
+// 返回值:
+//
+//	[]byte: 命令的标准输出。
+//	error: 如果日志文件创建或命令执行失败，返回错误信息；否则返回 nil。
+func (r *Run) Exec(step string, cmd *exec.Cmd) ([]byte, error) {
+	path := r.nextFile(step)
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("创建步骤日志文件失败: %v", err)
+	}
+	defer file.Close()
+
+	start := time.Now()
+	fmt.Fprintf(file, "当前时间: %s\n执行命令: %s\n\n", start.Format("2006-01-02 15:04:05"), redact.String(strings.Join(cmd.Args, " ")))
+
+	// 写入文件的输出屏蔽密钥，返回给调用方的 stdout 保持原样用于解析
+	var stdout bytes.Buffer
+	stdoutFile := redact.NewWriter(file)
+	stderrFile := redact.NewWriter(file)
+	cmd.Stdout = io.MultiWriter(stdoutFile, &stdout)
+	cmd.Stderr = stderrFile
+	err = cmd.Run()
+	stdoutFile.Flush()
+	stderrFile.Flush()
+	cost := time.Since(start).Round(time.Millisecond)
+
+	fmt.Fprintf(file, "\n退出状态: %v, 耗时: %v\n", exitStatus(err), cost)
+	if err != nil {
+		warnLogger.Printf("步骤 %s 执行失败 (%v), 耗时 %v, 执行过程见 %s", step, err, cost, path)
+		return stdout.Bytes(), err
+	}
+	infoLogger.Printf("步骤 %s 执行完成, 耗时 %v, 输出见 %s", step, cost, path)
+	return stdout.Bytes(), nil
+}
+
+// Cleanup 仅保留 baseDir 下最新的 keep 个运行目录，名称不以时间开头的子目录（例如补齐登录服的 resync）不计入也不清理。
+// 参数:
+//
+//	baseDir: 运行日志根目录。
+//	keep: 保留的运行目录数量。
+//
+// 返回值:
+//
+//	error: 如果读取或删除目录失败，返回错误信息；否则返回 nil。
+func Cleanup(baseDir string, keep int) error {
+	entries, err := os.ReadDir(baseDir)
+	if err != nil {
+		return err
+	}
+	dirs := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() && isRunDir(entry.Name()) {
+			dirs = append(dirs, entry.Name())
+		}
+	}
+	if len(dirs) <= keep {
+		return nil
+	}
+
+	// 目录名以时间开头，按名称排序即按时间排序
+	sort.Strings(dirs)
+	for _, name := range dirs[:len(dirs)-keep] {
+		if err = os.RemoveAll(filepath.Join(baseDir, name)); err != nil {
+			return err
+		}
+		infoLogger.Printf("已清理旧运行日志: %s", name)
+	}
+	return nil
+}
+
+// isRunDir 判断目录名是否为 Start 创建的运行目录
+func isRunDir(name string) bool {
+	if len(name) < len(timeLayout) {
+		return false
+	}
+	_, err := time.Parse(timeLayout, name[:len(timeLayout)])
+	return err == nil
+}
+
+func (r *Run) nextFile(step string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seq++
+	return filepath.Join(r.Dir, fmt.Sprintf("%02d-%s.log", r.seq, sanitize(step)))
+}
+
+func sanitize(name string) string {
+	return strings.Trim(unsafeChars.ReplaceAllString(name, "_"), "_")
+}
+
+func exitStatus(err error) string {
+	if err == nil {
+		return "0"
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return fmt.Sprintf("%d", exitErr.ExitCode())
+	}
+	return err.Error()
+}
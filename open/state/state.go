@@ -0,0 +1,202 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// State 守护进程需要跨重启保留的状态，保存在 state.json 中。
+type State struct {
+	// Prewarmed 已预装并以隐藏状态启动的 game 编号，0 表示没有。
+	Prewarmed int `json:"prewarmed"`
+	// Ports 已部署 game 的端口，键为 game 编号。
+	Ports map[int]int `json:"ports,omitempty"`
+	// Versions 已部署 game 的安装包 SHA-256，键为 game 编号。
+	Versions map[int]string `json:"versions,omitempty"`
+	// Stragglers 按多数派策略开服时更新失败、待下一轮补齐的登录服操作。
+	Stragglers []Straggler `json:"stragglers,omitempty"`
+	// PendingReload 名单已写入、尚未成功重载的登录服。进程在写入名单和重载之间重启时，
+	// 重新比对名单已无差异，只能靠这里的记录继续重载。
+	PendingReload []string `json:"pending_reload,omitempty"`
+
+	mu   sync.Mutex
+	path string
+}
+
+// Straggler 一个待补齐的登录服操作。
+type Straggler struct {
+	Host string `json:"host"`
+	Op   string `json:"op"`  // 名单类型 white 或 limit，或 reload 表示只需重载
+	Num  int    `json:"num"` // 失败时开服的 game 编号
+}
+
+// Load 从指定文件加载状态，文件不存在或为空时返回空状态。
+// 参数:
+//
+//	path: 状态文件路径。
+//
+// 返回值:
+//
+//	*State: 加载的状态。
+//	error: 如果文件读取或解析失败，返回错误信息；否则返回 nil。
+func Load(path string) (*State, error) {
+	s := &State{path: path}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("读取状态文件失败: %v", err)
+	}
+	if len(content) == 0 {
+		return s, nil
+	}
+	if err = json.Unmarshal(content, s); err != nil {
+		return nil, fmt.Errorf("解析状态文件失败: %v", err)
+	}
+	return s, nil
+}
+
+// Update 在锁内修改状态并写回文件。
+// 参数:
+//
+//	fn: 修改状态的函数。
+//
+// 返回值:
+//
+//	error: 如果写入文件失败，返回错误信息；否则返回 nil。
+func (s *State) Update(fn func(*State)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(s)
+	return s.save()
+}
+
+// RecordPort 记录 game 编号使用的端口并写回文件。
+func (s *State) RecordPort(num, port int) error {
+	return s.Update(func(s *State) {
+		if s.Ports == nil {
+			s.Ports = make(map[int]int)
+		}
+		s.Ports[num] = port
+	})
+}
+
+// RecordVersion 记录 game 编号部署的安装包 SHA-256 并写回文件。
+func (s *State) RecordVersion(num int, sha256 string) error {
+	return s.Update(func(s *State) {
+		if s.Versions == nil {
+			s.Versions = make(map[int]string)
+		}
+		s.Versions[num] = sha256
+	})
+}
+
+// Installed 判断 game 编号是否已部署，部署成功后才会记录安装包版本。
+func (s *State) Installed(num int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.Versions[num]
+	return ok
+}
+
+// MarkReload 记录名单已变更、待重载的登录服并写回文件。
+func (s *State) MarkReload(host string) error {
+	return s.Update(func(s *State) {
+		for _, h := range s.PendingReload {
+			if h == host {
+				return
+			}
+		}
+		s.PendingReload = append(s.PendingReload, host)
+	})
+}
+
+// AddStragglers 记录待补齐的登录服操作并写回文件，同一登录服的同一操作只保留一条，game 编号更新为最新一次失败的编号。
+func (s *State) AddStragglers(stragglers ...Straggler) error {
+	return s.Update(func(s *State) {
+		for _, st := range stragglers {
+			exists := false
+			for i, other := range s.Stragglers {
+				if other.Host == st.Host && other.Op == st.Op {
+					s.Stragglers[i].Num = st.Num
+					exists = true
+					break
+				}
+			}
+			if !exists {
+				s.Stragglers = append(s.Stragglers, st)
+			}
+		}
+	})
+}
+
+// ClearReload 移除已重载或已转为待补齐的登录服并写回文件。
+func (s *State) ClearReload(hosts ...string) error {
+	return s.Update(func(s *State) {
+		kept := s.PendingReload[:0]
+		for _, h := range s.PendingReload {
+			cleared := false
+			for _, host := range hosts {
+				if h == host {
+					cleared = true
+					break
+				}
+			}
+			if !cleared {
+				kept = append(kept, h)
+			}
+		}
+		s.PendingReload = kept
+	})
+}
+
+// PendingReloads 返回待重载登录服的副本。
+func (s *State) PendingReloads() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.PendingReload...)
+}
+
+// RecordedPorts 返回已记录端口的副本。
+func (s *State) RecordedPorts() map[int]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ports := make(map[int]int, len(s.Ports))
+	for num, port := range s.Ports {
+		ports[num] = port
+	}
+	return ports
+}
+
+// Get 在锁内读取状态。
+func (s *State) Get(fn func(*State)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(s)
+}
+
+// save 先写临时文件再覆盖，避免写到一半时退出导致状态文件损坏。
+// 挂载为单个文件时无法 rename 覆盖，退回直接写入。
+func (s *State) save() error {
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化状态失败: %v", err)
+	}
+	content = append(content, '\n')
+
+	tmp := filepath.Join(filepath.Dir(s.path), "."+filepath.Base(s.path)+".tmp")
+	if err = os.WriteFile(tmp, content, 0644); err == nil {
+		if err = os.Rename(tmp, s.path); err == nil {
+			return nil
+		}
+		os.Remove(tmp)
+	}
+	if err = os.WriteFile(s.path, content, 0644); err != nil {
+		return fmt.Errorf("写入状态文件失败: %v", err)
+	}
+	return nil
+}
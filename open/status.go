@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"open/history"
+	"open/logdb"
+)
+
+// projectStatus 状态接口返回的单个项目状态
+type projectStatus struct {
+	Project          string         `json:"project,omitempty"`
+	CurrentNum       int            `json:"current_num"`
+	Register         int            `json:"register"`
+	Payers           int            `json:"payers"`
+	Online           *int           `json:"online,omitempty"`        // 未配置在线人数来源或查询失败时为空
+	RegisterRate     *float64       `json:"register_rate,omitempty"` // 统计窗口内的每分钟注册人数，采样不足时为空
+	SampledAt        time.Time      `json:"sampled_at,omitempty"`
+	CriticalRegister int            `json:"critical_register"`
+	CriticalPayers   int            `json:"critical_payers"`
+	CriticalMoney    int            `json:"critical_money"`
+	CriticalOnline   int            `json:"critical_online,omitempty"`
+	Metrics          logdb.Status   `json:"metrics"`                // 日志库不可用时暂停开服判断
+	LastFailure      *switchFailure `json:"last_failure,omitempty"` // 最近一次开服中止的原因，开服成功后清除
+}
+
+// switchFailure 开服中止的原因
+type switchFailure struct {
+	Num        int       `json:"num"`
+	Step       string    `json:"step"`
+	FailedTask string    `json:"failed_task,omitempty"` // ansible 中出错的任务名
+	Host       string    `json:"host,omitempty"`
+	LastError  string    `json:"last_error"`
+	RunDir     string    `json:"run_dir,omitempty"`
+	At         time.Time `json:"at"`
+}
+
+// snapshot 返回项目的当前状态
+func (p *project) snapshot() projectStatus {
+	p.statusMu.Lock()
+	status := p.status
+	p.statusMu.Unlock()
+	status.CriticalRegister = p.criticalRegisterCount
+	status.CriticalPayers = p.criticalRechargeCount
+	status.CriticalMoney = p.criticalMoney
+	status.CriticalOnline = p.criticalOnline
+	status.Metrics = p.db.Status()
+	return status
+}
+
+// serveStatus 启动状态接口，提供以下只读接口：
+//
+//	GET /status: 所有项目的当前 game、指标、注册速率、日志库状态和最近一次开服中止的原因。
+//	GET /history?num=N&project=名称: game N 的所有采样，不指定 num 时为当前 game，单项目时不需要 project。
+func serveStatus(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		statuses := make([]projectStatus, 0, len(projects))
+		for _, p := range projects {
+			statuses = append(statuses, p.snapshot())
+		}
+		writeJSON(w, http.StatusOK, statuses)
+	})
+	mux.HandleFunc("/history", func(w http.ResponseWriter, r *http.Request) {
+		var target *project
+		for _, p := range projects {
+			if p.name == r.URL.Query().Get("project") {
+				target = p
+			}
+		}
+		if target == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "项目不存在"})
+			return
+		}
+		num := target.snapshot().CurrentNum
+		if v := r.URL.Query().Get("num"); v != "" {
+			var err error
+			if num, err = strconv.Atoi(v); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "game 编号无效"})
+				return
+			}
+		}
+		samples, err := target.history.Load(num)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		if samples == nil {
+			samples = []history.Sample{}
+		}
+		writeJSON(w, http.StatusOK, samples)
+	})
+
+	infoLogger.Printf("状态接口监听 %s", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		errLogger.Printf("状态接口启动失败: %v", err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// historyCommand 实现 open history N [项目名]，输出 game N 的采样和注册速率，直接读取采样文件，不需要守护进程在运行。
+// 参数:
+//
+//	args: 命令参数，第一个为 game 编号，多项目时第二个为项目名。
+//
+// 返回值:
+//
+//	error: 如果参数无效或读取失败，返回错误信息；否则返回 nil。
+func historyCommand(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errors.New("用法: open history <game 编号> [项目名]")
+	}
+	num, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("game 编号无效: %s", args[0])
+	}
+	var name string
+	getenv := os.Getenv
+	if len(args) == 2 {
+		name = args[1]
+		// 与 loadProjects 相同，项目的 project.env 覆盖环境变量，保证注册速率与守护进程一致
+		overrides, err := loadEnvFile(filepath.Join(currentDir, projectsDir, name, projectEnvFileName))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("项目 %s 配置文件读取失败: %v", name, err)
+		}
+		getenv = envLookup(overrides)
+	} else if _, err = os.Stat(filepath.Join(currentDir, projectsDir)); err == nil {
+		return errors.New("多项目时需要指定项目名: open history <game 编号> <项目名>")
+	}
+
+	window, err := rateWindowEnv(getenv)
+	if err != nil {
+		return err
+	}
+
+	store := &history.Store{Dir: filepath.Join(currentDir, historyDir, name)}
+	samples, err := store.Load(num)
+	if err != nil {
+		return err
+	}
+	if len(samples) == 0 {
+		return fmt.Errorf("game%d 没有采样记录", num)
+	}
+	fmt.Printf("%-19s  %8s  %8s  %8s  %s\n", "时间", "注册", "付费", "在线", fmt.Sprintf("注册速率(人/分钟, 最近 %s)", window))
+	for i, sample := range samples {
+		rate := "-"
+		if r, ok := history.Rate(samples[:i+1], window); ok {
+			rate = fmt.Sprintf("%.1f", r)
+		}
+		online := "-"
+		if sample.Online != nil {
+			online = strconv.Itoa(*sample.Online)
+		}
+		fmt.Printf("%-19s  %8d  %8d  %8s  %s\n", sample.Time.Format("2006-01-02 15:04:05"), sample.Register, sample.Payers, online, rate)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package verify
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"open/check"
+	"open/execute"
+	"open/loglevel"
+	"open/runlog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const dialTimeout = 5 * time.Second
+
+var (
+	infoLogger    = loglevel.GetInfoLogger()
+	successLogger = loglevel.GetSuccessLogger()
+	errLogger     = loglevel.GetErrLogger()
+)
+
+// Options 开服后验证所需的参数。
+type Options struct {
+	GameNum   int      // 新开 game 编号
+	PrevNum   int      // 上一个 game 编号，应出现在限制名单中
+	GameIP    string   // 新开 game 所在 IP
+	GamePort  int      // 新开 game 服务端口
+	Probe     string   // 应用层探测地址，支持 http://、https://、tcp://，可使用 {ip} {port} {num} 占位符，为空表示不探测
+	LoginIPs  []string // 所有 login 节点 IP
+	WhitePath string   // login 节点上白名单文件路径
+	LimitPath string   // login 节点上限制名单文件路径
+}
+
+// Run 验证新开 game 是否真正对外提供服务，并确认白名单与限制名单已生效。
+// 参数:
+//
+//	run: 本次运行对象，ansible 输出写入其步骤日志文件。
+//	opts: 验证参数。
+//
+// 返回值:
+//
+//	*check.Report: 每项验证的结果。
+func Run(run *runlog.Run, opts Options) *check.Report {
+	report := new(check.Report)
+	infoLogger.Printf("正在执行开服后验证, game 编号为:%d IP:%s", opts.GameNum, opts.GameIP)
+
+	gameAddr := net.JoinHostPort(opts.GameIP, strconv.Itoa(opts.GamePort))
+	report.Add("game 端口连通", gameAddr, dialTCP(gameAddr))
+
+	if opts.Probe != "" {
+		target := expand(opts.Probe, opts)
+		report.Add("应用层探测", target, probe(target))
+	}
+
+	whiteErrs := execute.Adhoc(run, "verify-whitelist", opts.LoginIPs, "shell",
+		fmt.Sprintf("if grep -qx '%d' %s; then echo '%d 仍在白名单中'; exit 1; fi",
+			opts.GameNum, opts.WhitePath, opts.GameNum))
+	for _, ip := range opts.LoginIPs {
+		report.Add("白名单已移除", fmt.Sprintf("%s:%d", ip, opts.GameNum), whiteErrs[ip])
+	}
+
+	limitErrs := execute.Adhoc(run, "verify-limit", opts.LoginIPs, "shell",
+		fmt.Sprintf("grep -qx '%d' %s || { echo '%d 不在限制名单中'; exit 1; }",
+			opts.PrevNum, opts.LimitPath, opts.PrevNum))
+	for _, ip := range opts.LoginIPs {
+		report.Add("限制名单已加入", fmt.Sprintf("%s:%d", ip, opts.PrevNum), limitErrs[ip])
+	}
+
+	if report.Failed() {
+		errLogger.Printf("开服后验证未通过, game 编号为:%d\n%s", opts.GameNum, report)
+	} else {
+		successLogger.Printf("开服后验证通过, game 编号为:%d\n%s", opts.GameNum, report)
+	}
+	return report
+}
+
+// expand 替换探测地址中的 {ip} {port} {num} 占位符。
+func expand(probe string, opts Options) string {
+	return strings.NewReplacer(
+		"{ip}", opts.GameIP,
+		"{port}", strconv.Itoa(opts.GamePort),
+		"{num}", strconv.Itoa(opts.GameNum),
+	).Replace(probe)
+}
+
+// probe 按地址协议执行 HTTP 或 TCP 探测。
+func probe(target string) error {
+	u, err := url.Parse(target)
+	if err != nil {
+		return fmt.Errorf("探测地址无效: %v", err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		client := &http.Client{Timeout: dialTimeout}
+		resp, err := client.Get(target)
+		if err != nil {
+			return fmt.Errorf("HTTP 请求失败: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("HTTP 状态码错误: %d", resp.StatusCode)
+		}
+		return nil
+	case "tcp":
+		return dialTCP(u.Host)
+	default:
+		return fmt.Errorf("不支持的探测协议: %s", u.Scheme)
+	}
+}
+
+func dialTCP(addr string) error {
+	conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}